@@ -0,0 +1,239 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Partitions owned by a consumer as returned by the /assignment admin endpoint.
+type AdminAssignment struct {
+	// Consumer id.
+	Consumerid string
+
+	// Consumer group.
+	Groupid string
+
+	// Owned partitions grouped by topic.
+	Partitions map[string][]int32
+
+	// Offsets to fetch from for owned partitions grouped by topic.
+	FetchedOffsets map[string]map[int32]int64
+}
+
+// State of a single WorkerManager as returned by the /workers admin endpoint.
+type AdminWorkerManager struct {
+	// WorkerManager id.
+	Id string
+
+	// Topic processed by the WorkerManager.
+	Topic string
+
+	// Partition processed by the WorkerManager.
+	Partition int32
+
+	// Number of messages received but not processed yet.
+	PendingTasks int
+
+	// Largest processed offset.
+	LargestOffset int64
+
+	// Last committed offset.
+	CommittedOffset int64
+
+	// Lowest offset that failed and is not committed, so no offsets after it are committed until restart. InvalidOffset if there is none.
+	StuckOffset int64
+}
+
+// Result of /pause and /resume admin endpoints.
+type AdminPauseState struct {
+	// Whether the consumer is paused for all partitions.
+	Paused bool
+
+	// Partitions that are not fetched grouped by topic.
+	PausedPartitions map[string][]int32
+}
+
+// Starts serving the HTTP admin endpoint on ConsumerConfig.AdminAddr.
+func (c *Consumer) startAdmin() error {
+	listener, err := net.Listen("tcp", c.config.AdminAddr)
+	if err != nil {
+		return err
+	}
+	c.adminListener = listener
+
+	Infof(c, "Serving admin endpoint on %s", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, c.adminHandler()); err != nil && !c.isShuttingdown {
+			Errorf(c, "Admin endpoint stopped: %s", err)
+		}
+	}()
+	return nil
+}
+
+func (c *Consumer) stopAdmin() {
+	if c.adminListener != nil {
+		c.adminListener.Close()
+	}
+}
+
+func (c *Consumer) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := c.StateSnapshot()
+		// JSON has no representation for NaN and infinities some metrics may have
+		for _, values := range snapshot.Metrics {
+			for name, value := range values {
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					values[name] = 0
+				}
+			}
+		}
+		writeAdminJson(w, snapshot)
+	})
+	mux.HandleFunc("/assignment", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJson(w, c.assignment())
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, c.config.String())
+	})
+	mux.HandleFunc("/workers", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJson(w, c.workerManagersState())
+	})
+	mux.Handle("/metrics", NewPrometheusExporter(c.config.MetricsRegistry, ""))
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Use POST to pause the consumer", http.StatusMethodNotAllowed)
+			return
+		}
+		topicPartitions, err := adminTopicPartitions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Pause(topicPartitions...)
+		writeAdminJson(w, c.pauseState())
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Use POST to resume the consumer", http.StatusMethodNotAllowed)
+			return
+		}
+		topicPartitions, err := adminTopicPartitions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Resume(topicPartitions...)
+		writeAdminJson(w, c.pauseState())
+	})
+
+	return mux
+}
+
+// Returns a partition given with topic and partition query parameters, e.g. /pause?topic=events&partition=3, or none to pause or resume the whole consumer.
+func adminTopicPartitions(r *http.Request) ([]TopicAndPartition, error) {
+	topic := r.FormValue("topic")
+	partition := r.FormValue("partition")
+	if topic == "" && partition == "" {
+		return nil, nil
+	}
+	if topic == "" || partition == "" {
+		return nil, errors.New("Both topic and partition should be given")
+	}
+	partitionId, err := strconv.ParseInt(partition, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid partition %s", partition)
+	}
+	return []TopicAndPartition{TopicAndPartition{topic, int32(partitionId)}}, nil
+}
+
+func (c *Consumer) pauseState() *AdminPauseState {
+	state := &AdminPauseState{
+		Paused:           c.IsPaused(),
+		PausedPartitions: make(map[string][]int32),
+	}
+	for _, topicPartition := range c.Paused() {
+		state.PausedPartitions[topicPartition.Topic] = append(state.PausedPartitions[topicPartition.Topic], topicPartition.Partition)
+	}
+	return state
+}
+
+func (c *Consumer) assignment() *AdminAssignment {
+	assignment := &AdminAssignment{
+		Consumerid:     c.config.Consumerid,
+		Groupid:        c.config.Groupid,
+		Partitions:     make(map[string][]int32),
+		FetchedOffsets: make(map[string]map[int32]int64),
+	}
+
+	inLock(&c.rebalanceLock, func() {
+		for topic, partitions := range c.topicRegistry {
+			assignment.FetchedOffsets[topic] = make(map[int32]int64)
+			for partition, info := range partitions {
+				assignment.Partitions[topic] = append(assignment.Partitions[topic], partition)
+				assignment.FetchedOffsets[topic][partition] = info.FetchedOffset
+			}
+			sort.Sort(intArray(assignment.Partitions[topic]))
+		}
+	})
+
+	return assignment
+}
+
+func (c *Consumer) workerManagersState() []*AdminWorkerManager {
+	workerManagers := make([]*AdminWorkerManager, 0)
+	inLock(&c.workerManagersLock, func() {
+		for topicPartition, wm := range c.workerManagers {
+			workerManagers = append(workerManagers, &AdminWorkerManager{
+				Id:              wm.String(),
+				Topic:           topicPartition.Topic,
+				Partition:       topicPartition.Partition,
+				PendingTasks:    wm.GetPendingTasks(),
+				LargestOffset:   wm.GetLargestOffset(),
+				CommittedOffset: wm.GetLastCommittedOffset(),
+				StuckOffset:     wm.GetStuckOffset(),
+			})
+		}
+	})
+	sort.Sort(byAdminWorkerManagerId(workerManagers))
+
+	return workerManagers
+}
+
+type byAdminWorkerManagerId []*AdminWorkerManager
+
+func (a byAdminWorkerManagerId) Len() int           { return len(a) }
+func (a byAdminWorkerManagerId) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byAdminWorkerManagerId) Less(i, j int) bool { return a[i].Id < a[j].Id }
+
+func writeAdminJson(w http.ResponseWriter, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
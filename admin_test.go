@@ -0,0 +1,117 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	metrics "github.com/rcrowley/go-metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminEndpoint(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Groupid = "admin-group"
+	config.Consumerid = "admin-consumer"
+	config.MetricsRegistry = metrics.NewRegistry()
+	askNext := make(chan TopicAndPartition, 10)
+	consumer := &Consumer{
+		config:         config,
+		topicRegistry:  make(map[string]map[int32]*partitionTopicInfo),
+		workerManagers: make(map[TopicAndPartition]*WorkerManager),
+		fetcher: &consumerFetcherManager{
+			config:         config,
+			askNext:        askNext,
+			highWatermarks: make(map[TopicAndPartition]int64),
+			pausedAsks:       make(map[TopicAndPartition]bool),
+			pausedPartitions: make(map[TopicAndPartition]bool),
+		},
+	}
+	topicPartition := TopicAndPartition{"fakeTopic", 1}
+	consumer.topicRegistry["fakeTopic"] = map[int32]*partitionTopicInfo{
+		1: &partitionTopicInfo{Topic: "fakeTopic", Partition: 1, FetchedOffset: 10},
+		0: &partitionTopicInfo{Topic: "fakeTopic", Partition: 0, FetchedOffset: 5},
+	}
+	wm := &WorkerManager{id: "WM-fakeTopic-1", offsetTracker: newOffsetTracker(), largestOffset: 11, lastCommittedOffset: 9}
+	wm.offsetTracker.add(12)
+	consumer.workerManagers[topicPartition] = wm
+	consumer.fetcher.updateHighWatermark(topicPartition, 20)
+	handler := consumer.adminHandler()
+
+	assignment := &AdminAssignment{}
+	assert(t, adminRequest(t, handler, "GET", "/assignment", assignment), http.StatusOK)
+	assert(t, assignment, &AdminAssignment{
+		Consumerid:     "admin-consumer",
+		Groupid:        "admin-group",
+		Partitions:     map[string][]int32{"fakeTopic": []int32{0, 1}},
+		FetchedOffsets: map[string]map[int32]int64{"fakeTopic": map[int32]int64{0: 5, 1: 10}},
+	})
+
+	workers := make([]*AdminWorkerManager, 0)
+	assert(t, adminRequest(t, handler, "GET", "/workers", &workers), http.StatusOK)
+	assert(t, workers, []*AdminWorkerManager{&AdminWorkerManager{"WM-fakeTopic-1", "fakeTopic", 1, 1, 11, 9, InvalidOffset}})
+
+	state := &StateSnapshot{}
+	assert(t, adminRequest(t, handler, "GET", "/state", state), http.StatusOK)
+	assert(t, state.Offsets, map[string]map[int32]int64{"fakeTopic": map[int32]int64{1: 11}})
+	assert(t, *state.Lags["fakeTopic"][1], *NewPartitionLag(20, 9, 11))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/config", nil))
+	assert(t, strings.Contains(recorder.Body.String(), "GroupId: admin-group"), true)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert(t, recorder.Code, http.StatusOK)
+	assert(t, recorder.Header().Get("Content-Type"), prometheusContentType)
+
+	//pausing defers fetch requests until resumed
+	pauseState := &AdminPauseState{}
+	assert(t, adminRequest(t, handler, "GET", "/pause", nil), http.StatusMethodNotAllowed)
+	assert(t, adminRequest(t, handler, "POST", "/pause", pauseState), http.StatusOK)
+	assert(t, pauseState, &AdminPauseState{true, map[string][]int32{"fakeTopic": []int32{1}}})
+	assert(t, consumer.fetcher.deferIfPaused(topicPartition), true)
+	pauseState = &AdminPauseState{}
+	assert(t, adminRequest(t, handler, "POST", "/resume", pauseState), http.StatusOK)
+	assert(t, pauseState, &AdminPauseState{false, map[string][]int32{}})
+	assert(t, consumer.fetcher.deferIfPaused(topicPartition), false)
+	select {
+	case asked := <-askNext:
+		assert(t, asked, topicPartition)
+	case <-time.After(time.Second):
+		t.Error("Deferred fetch request should be asked again once resumed")
+	}
+
+	pauseState = &AdminPauseState{}
+	assert(t, adminRequest(t, handler, "POST", "/pause?topic=fakeTopic&partition=0", pauseState), http.StatusOK)
+	assert(t, pauseState, &AdminPauseState{false, map[string][]int32{"fakeTopic": []int32{0}}})
+	assert(t, adminRequest(t, handler, "POST", "/pause?topic=fakeTopic", nil), http.StatusBadRequest)
+	assert(t, adminRequest(t, handler, "POST", "/resume?topic=fakeTopic&partition=zero", nil), http.StatusBadRequest)
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method string, path string, response interface{}) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	if response != nil && recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Errorf("Failed to decode response for %s: %s", path, err)
+		}
+	}
+	return recorder.Code
+}
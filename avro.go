@@ -0,0 +1,755 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const (
+	avroNull    = "null"
+	avroBoolean = "boolean"
+	avroInt     = "int"
+	avroLong    = "long"
+	avroFloat   = "float"
+	avroDouble  = "double"
+	avroBytes   = "bytes"
+	avroString  = "string"
+	avroRecord  = "record"
+	avroError   = "error"
+	avroEnum    = "enum"
+	avroArray   = "array"
+	avroMap     = "map"
+	avroFixed   = "fixed"
+	avroUnion   = "union"
+)
+
+var errAvroShortBuffer = errors.New("Unexpected end of Avro data")
+
+// AvroSchema is a parsed Avro schema.
+type AvroSchema struct {
+	// Schema type: one of Avro primitive types, "record", "enum", "array", "map", "fixed" or "union".
+	Type string
+
+	// Full name of a named type (record, enum or fixed).
+	Name string
+
+	// Fields of a record.
+	Fields []*AvroField
+
+	// Symbols of an enum.
+	Symbols []string
+
+	// Item schema of an array.
+	Items *AvroSchema
+
+	// Value schema of a map.
+	Values *AvroSchema
+
+	// Branches of a union.
+	Branches []*AvroSchema
+
+	// Size of a fixed.
+	Size int
+}
+
+// AvroField is a single field of an Avro record.
+type AvroField struct {
+	// Field name.
+	Name string
+
+	// Field schema.
+	Type *AvroSchema
+}
+
+// Parses a given Avro schema in JSON format. Returns an error if the schema is malformed or references unknown types.
+func ParseAvroSchema(schema string) (*AvroSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(schema), &raw); err != nil {
+		// a primitive type name may be given without quotes
+		raw = strings.TrimSpace(schema)
+	}
+
+	return parseAvroSchema(raw, make(map[string]*AvroSchema), "")
+}
+
+func parseAvroSchema(raw interface{}, names map[string]*AvroSchema, namespace string) (*AvroSchema, error) {
+	switch schema := raw.(type) {
+	case string:
+		{
+			switch schema {
+			case avroNull, avroBoolean, avroInt, avroLong, avroFloat, avroDouble, avroBytes, avroString:
+				return &AvroSchema{Type: schema}, nil
+			}
+			if named, exists := names[avroFullName(schema, namespace)]; exists {
+				return named, nil
+			}
+			if named, exists := names[schema]; exists {
+				return named, nil
+			}
+			return nil, fmt.Errorf("Unknown Avro type %s", schema)
+		}
+	case []interface{}:
+		{
+			union := &AvroSchema{Type: avroUnion}
+			for _, rawBranch := range schema {
+				branch, err := parseAvroSchema(rawBranch, names, namespace)
+				if err != nil {
+					return nil, err
+				}
+				union.Branches = append(union.Branches, branch)
+			}
+			return union, nil
+		}
+	case map[string]interface{}:
+		return parseComplexAvroSchema(schema, names, namespace)
+	}
+
+	return nil, fmt.Errorf("Invalid Avro schema %v", raw)
+}
+
+func parseComplexAvroSchema(schema map[string]interface{}, names map[string]*AvroSchema, namespace string) (*AvroSchema, error) {
+	switch schemaType := schema["type"].(type) {
+	case string:
+		{
+			switch schemaType {
+			case avroRecord, avroError, avroEnum, avroFixed:
+				return parseNamedAvroSchema(schemaType, schema, names, namespace)
+			case avroArray:
+				{
+					items, err := parseAvroSchema(schema["items"], names, namespace)
+					if err != nil {
+						return nil, err
+					}
+					return &AvroSchema{Type: avroArray, Items: items}, nil
+				}
+			case avroMap:
+				{
+					values, err := parseAvroSchema(schema["values"], names, namespace)
+					if err != nil {
+						return nil, err
+					}
+					return &AvroSchema{Type: avroMap, Values: values}, nil
+				}
+			default:
+				return parseAvroSchema(schemaType, names, namespace)
+			}
+		}
+	case nil:
+		return nil, errors.New("Avro schema has no type")
+	default:
+		return parseAvroSchema(schemaType, names, namespace)
+	}
+}
+
+func parseNamedAvroSchema(schemaType string, schema map[string]interface{}, names map[string]*AvroSchema, namespace string) (*AvroSchema, error) {
+	name, _ := schema["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("Avro %s has no name", schemaType)
+	}
+	if ns, ok := schema["namespace"].(string); ok && ns != "" {
+		namespace = ns
+	}
+	fullName := avroFullName(name, namespace)
+	if dot := strings.LastIndex(fullName, "."); dot >= 0 {
+		namespace = fullName[:dot]
+	}
+
+	named := &AvroSchema{Type: schemaType, Name: fullName}
+	if schemaType == avroError {
+		named.Type = avroRecord
+	}
+	names[fullName] = named
+
+	switch schemaType {
+	case avroRecord, avroError:
+		{
+			rawFields, _ := schema["fields"].([]interface{})
+			for _, rawField := range rawFields {
+				field, _ := rawField.(map[string]interface{})
+				fieldName, _ := field["name"].(string)
+				if fieldName == "" {
+					return nil, fmt.Errorf("Avro record %s has a field without name", fullName)
+				}
+				fieldType, err := parseAvroSchema(field["type"], names, namespace)
+				if err != nil {
+					return nil, err
+				}
+				named.Fields = append(named.Fields, &AvroField{fieldName, fieldType})
+			}
+		}
+	case avroEnum:
+		{
+			rawSymbols, _ := schema["symbols"].([]interface{})
+			for _, rawSymbol := range rawSymbols {
+				symbol, _ := rawSymbol.(string)
+				named.Symbols = append(named.Symbols, symbol)
+			}
+		}
+	case avroFixed:
+		{
+			size, ok := schema["size"].(float64)
+			if !ok || size < 0 {
+				return nil, fmt.Errorf("Avro fixed %s has invalid size", fullName)
+			}
+			named.Size = int(size)
+		}
+	}
+
+	return named, nil
+}
+
+func avroFullName(name string, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// Decodes given Avro binary data written with this schema into generic values:
+// records and maps are decoded into map[string]interface{}, arrays into []interface{}, enums into string,
+// bytes and fixed into []byte, int into int32, long into int64, float into float32, double into float64, and null into nil.
+// Unions are decoded into the value of the written branch.
+func (s *AvroSchema) Decode(data []byte) (interface{}, error) {
+	reader := &avroReader{data: data}
+	value, err := reader.read(s)
+	if err != nil {
+		return nil, err
+	}
+	if reader.pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected trailing bytes after Avro data", len(data)-reader.pos)
+	}
+	return value, nil
+}
+
+type avroReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *avroReader) read(schema *AvroSchema) (interface{}, error) {
+	switch schema.Type {
+	case avroNull:
+		return nil, nil
+	case avroBoolean:
+		{
+			b, err := r.next(1)
+			if err != nil {
+				return nil, err
+			}
+			return b[0] != 0, nil
+		}
+	case avroInt:
+		{
+			value, err := r.long()
+			return int32(value), err
+		}
+	case avroLong:
+		return r.long()
+	case avroFloat:
+		{
+			b, err := r.next(4)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+		}
+	case avroDouble:
+		{
+			b, err := r.next(8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+		}
+	case avroBytes:
+		return r.bytes()
+	case avroString:
+		{
+			b, err := r.bytes()
+			return string(b), err
+		}
+	case avroFixed:
+		{
+			b, err := r.next(schema.Size)
+			if err != nil {
+				return nil, err
+			}
+			return append([]byte(nil), b...), nil
+		}
+	case avroEnum:
+		{
+			index, err := r.long()
+			if err != nil {
+				return nil, err
+			}
+			if index < 0 || int(index) >= len(schema.Symbols) {
+				return nil, fmt.Errorf("Invalid symbol index %d for Avro enum %s", index, schema.Name)
+			}
+			return schema.Symbols[index], nil
+		}
+	case avroUnion:
+		{
+			index, err := r.long()
+			if err != nil {
+				return nil, err
+			}
+			if index < 0 || int(index) >= len(schema.Branches) {
+				return nil, fmt.Errorf("Invalid branch index %d for Avro union", index)
+			}
+			return r.read(schema.Branches[index])
+		}
+	case avroRecord:
+		{
+			record := make(map[string]interface{})
+			for _, field := range schema.Fields {
+				value, err := r.read(field.Type)
+				if err != nil {
+					return nil, err
+				}
+				record[field.Name] = value
+			}
+			return record, nil
+		}
+	case avroArray:
+		{
+			array := make([]interface{}, 0)
+			err := r.blocks(func() error {
+				item, err := r.read(schema.Items)
+				array = append(array, item)
+				return err
+			})
+			return array, err
+		}
+	case avroMap:
+		{
+			values := make(map[string]interface{})
+			err := r.blocks(func() error {
+				key, err := r.bytes()
+				if err != nil {
+					return err
+				}
+				value, err := r.read(schema.Values)
+				values[string(key)] = value
+				return err
+			})
+			return values, err
+		}
+	}
+
+	return nil, fmt.Errorf("Unsupported Avro type %s", schema.Type)
+}
+
+func (r *avroReader) next(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errAvroShortBuffer
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *avroReader) long() (int64, error) {
+	value, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errAvroShortBuffer
+	}
+	r.pos += n
+	return value, nil
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	length, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.next(int(length))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// Reads array or map blocks calling readItem for each item until the terminating empty block.
+func (r *avroReader) blocks(readItem func() error) error {
+	for {
+		count, err := r.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			count = -count
+			if _, err := r.long(); err != nil { //block size in bytes
+				return err
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			if err := readItem(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Decodes given Avro binary data written with this schema into a value pointed to by target.
+// Records are decoded into structs or maps, fields are matched by `avro` struct tags, exact names or case-insensitive names.
+func (s *AvroSchema) DecodeInto(data []byte, target interface{}) error {
+	value, err := s.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	pointer := reflect.ValueOf(target)
+	if pointer.Kind() != reflect.Ptr || pointer.IsNil() {
+		return fmt.Errorf("Avro value can be decoded only into a non-nil pointer, got %T", target)
+	}
+	return assignAvroValue(pointer.Elem(), value)
+}
+
+func assignAvroValue(target reflect.Value, value interface{}) error {
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	source := reflect.ValueOf(value)
+	switch target.Kind() {
+	case reflect.Interface:
+		{
+			if !source.Type().AssignableTo(target.Type()) {
+				return fmt.Errorf("Cannot assign Avro value of type %s to %s", source.Type(), target.Type())
+			}
+			target.Set(source)
+			return nil
+		}
+	case reflect.Ptr:
+		{
+			elem := reflect.New(target.Type().Elem())
+			if err := assignAvroValue(elem.Elem(), value); err != nil {
+				return err
+			}
+			target.Set(elem)
+			return nil
+		}
+	case reflect.Struct:
+		{
+			record, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("Cannot assign Avro value of type %s to %s", source.Type(), target.Type())
+			}
+			for name, fieldValue := range record {
+				if field := avroStructField(target, name); field.IsValid() {
+					if err := assignAvroValue(field, fieldValue); err != nil {
+						return fmt.Errorf("%s: %s", name, err)
+					}
+				}
+			}
+			return nil
+		}
+	case reflect.Slice:
+		{
+			if bytes, ok := value.([]byte); ok && target.Type().Elem().Kind() == reflect.Uint8 {
+				target.SetBytes(bytes)
+				return nil
+			}
+			items, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("Cannot assign Avro value of type %s to %s", source.Type(), target.Type())
+			}
+			slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+			for i, item := range items {
+				if err := assignAvroValue(slice.Index(i), item); err != nil {
+					return err
+				}
+			}
+			target.Set(slice)
+			return nil
+		}
+	case reflect.Map:
+		{
+			values, ok := value.(map[string]interface{})
+			if !ok || target.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("Cannot assign Avro value of type %s to %s", source.Type(), target.Type())
+			}
+			result := reflect.MakeMap(target.Type())
+			for key, item := range values {
+				elem := reflect.New(target.Type().Elem()).Elem()
+				if err := assignAvroValue(elem, item); err != nil {
+					return err
+				}
+				result.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), elem)
+			}
+			target.Set(result)
+			return nil
+		}
+	}
+
+	if avroKindClass(source.Kind()) != avroKindClass(target.Kind()) || !source.Type().ConvertibleTo(target.Type()) {
+		return fmt.Errorf("Cannot assign Avro value of type %s to %s", source.Type(), target.Type())
+	}
+	target.Set(source.Convert(target.Type()))
+	return nil
+}
+
+// Groups kinds that may be converted to each other without changing the meaning of a value.
+func avroKindClass(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	}
+	return kind.String()
+}
+
+// Finds a struct field for a given Avro field name by `avro` tag, exact name or case-insensitive name. Returns an invalid Value if there is no such field.
+func avroStructField(structValue reflect.Value, name string) reflect.Value {
+	structType := structValue.Type()
+	match := -1
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if tag := field.Tag.Get("avro"); tag != "" {
+			if tag == name {
+				return structValue.Field(i)
+			}
+			continue
+		}
+		if field.Name == name {
+			return structValue.Field(i)
+		}
+		if match < 0 && strings.EqualFold(field.Name, name) {
+			match = i
+		}
+	}
+
+	if match < 0 {
+		return reflect.Value{}
+	}
+	return structValue.Field(match)
+}
+
+// Encodes a given value into Avro binary format with this schema.
+// Records may be given as structs (see DecodeInto for field matching) or maps with string keys, enums as strings, unions as values of any branch type.
+func (s *AvroSchema) Encode(value interface{}) ([]byte, error) {
+	writer := new(avroWriter)
+	if err := writer.write(s, reflect.ValueOf(value)); err != nil {
+		return nil, err
+	}
+	return writer.buffer, nil
+}
+
+type avroWriter struct {
+	buffer []byte
+}
+
+func (w *avroWriter) write(schema *AvroSchema, value reflect.Value) error {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			value = reflect.Value{}
+		} else {
+			value = value.Elem()
+		}
+	}
+	if !value.IsValid() && schema.Type != avroNull && schema.Type != avroUnion {
+		return fmt.Errorf("Missing value for Avro type %s", schema.Type)
+	}
+
+	switch schema.Type {
+	case avroNull:
+		if value.IsValid() {
+			return fmt.Errorf("Cannot encode %s as Avro null", value.Type())
+		}
+	case avroBoolean:
+		{
+			if value.Kind() != reflect.Bool {
+				return fmt.Errorf("Cannot encode %s as Avro boolean", value.Type())
+			}
+			if value.Bool() {
+				w.buffer = append(w.buffer, 1)
+			} else {
+				w.buffer = append(w.buffer, 0)
+			}
+		}
+	case avroInt, avroLong:
+		{
+			switch value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				w.long(value.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				w.long(int64(value.Uint()))
+			default:
+				return fmt.Errorf("Cannot encode %s as Avro %s", value.Type(), schema.Type)
+			}
+		}
+	case avroFloat, avroDouble:
+		{
+			var number float64
+			switch avroKindClass(value.Kind()) {
+			case "number":
+				number = value.Convert(reflect.TypeOf(number)).Float()
+			default:
+				return fmt.Errorf("Cannot encode %s as Avro %s", value.Type(), schema.Type)
+			}
+			if schema.Type == avroFloat {
+				bits := make([]byte, 4)
+				binary.LittleEndian.PutUint32(bits, math.Float32bits(float32(number)))
+				w.buffer = append(w.buffer, bits...)
+			} else {
+				bits := make([]byte, 8)
+				binary.LittleEndian.PutUint64(bits, math.Float64bits(number))
+				w.buffer = append(w.buffer, bits...)
+			}
+		}
+	case avroBytes, avroString:
+		{
+			bytes, ok := avroBytesOf(value)
+			if !ok {
+				return fmt.Errorf("Cannot encode %s as Avro %s", value.Type(), schema.Type)
+			}
+			w.long(int64(len(bytes)))
+			w.buffer = append(w.buffer, bytes...)
+		}
+	case avroFixed:
+		{
+			bytes, ok := avroBytesOf(value)
+			if !ok || value.Kind() == reflect.String || len(bytes) != schema.Size {
+				return fmt.Errorf("Cannot encode %s as Avro fixed %s of size %d", value.Type(), schema.Name, schema.Size)
+			}
+			w.buffer = append(w.buffer, bytes...)
+		}
+	case avroEnum:
+		{
+			if value.Kind() != reflect.String {
+				return fmt.Errorf("Cannot encode %s as Avro enum %s", value.Type(), schema.Name)
+			}
+			for i, symbol := range schema.Symbols {
+				if symbol == value.String() {
+					w.long(int64(i))
+					return nil
+				}
+			}
+			return fmt.Errorf("Unknown symbol %s for Avro enum %s", value.String(), schema.Name)
+		}
+	case avroUnion:
+		{
+			for i, branch := range schema.Branches {
+				branchWriter := new(avroWriter)
+				branchWriter.long(int64(i))
+				if err := branchWriter.write(branch, value); err == nil {
+					w.buffer = append(w.buffer, branchWriter.buffer...)
+					return nil
+				}
+			}
+			if !value.IsValid() {
+				return errors.New("Cannot encode null as Avro union without null branch")
+			}
+			return fmt.Errorf("Cannot encode %s as any branch of Avro union", value.Type())
+		}
+	case avroRecord:
+		{
+			for _, field := range schema.Fields {
+				var fieldValue reflect.Value
+				switch value.Kind() {
+				case reflect.Struct:
+					fieldValue = avroStructField(value, field.Name)
+				case reflect.Map:
+					if value.Type().Key().Kind() == reflect.String {
+						fieldValue = value.MapIndex(reflect.ValueOf(field.Name).Convert(value.Type().Key()))
+					}
+				default:
+					return fmt.Errorf("Cannot encode %s as Avro record %s", value.Type(), schema.Name)
+				}
+				if err := w.write(field.Type, fieldValue); err != nil {
+					return fmt.Errorf("%s.%s: %s", schema.Name, field.Name, err)
+				}
+			}
+		}
+	case avroArray:
+		{
+			if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+				return fmt.Errorf("Cannot encode %s as Avro array", value.Type())
+			}
+			if value.Len() > 0 {
+				w.long(int64(value.Len()))
+				for i := 0; i < value.Len(); i++ {
+					if err := w.write(schema.Items, value.Index(i)); err != nil {
+						return err
+					}
+				}
+			}
+			w.long(0)
+		}
+	case avroMap:
+		{
+			if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("Cannot encode %s as Avro map", value.Type())
+			}
+			if value.Len() > 0 {
+				w.long(int64(value.Len()))
+				for _, key := range value.MapKeys() {
+					w.long(int64(len(key.String())))
+					w.buffer = append(w.buffer, key.String()...)
+					if err := w.write(schema.Values, value.MapIndex(key)); err != nil {
+						return err
+					}
+				}
+			}
+			w.long(0)
+		}
+	default:
+		return fmt.Errorf("Unsupported Avro type %s", schema.Type)
+	}
+
+	return nil
+}
+
+func (w *avroWriter) long(value int64) {
+	bytes := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(bytes, value)
+	w.buffer = append(w.buffer, bytes[:n]...)
+}
+
+func avroBytesOf(value reflect.Value) ([]byte, bool) {
+	switch {
+	case value.Kind() == reflect.String:
+		return []byte(value.String()), true
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		return value.Bytes(), true
+	case value.Kind() == reflect.Array && value.Type().Elem().Kind() == reflect.Uint8:
+		{
+			bytes := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(bytes), value)
+			return bytes, true
+		}
+	}
+	return nil, false
+}
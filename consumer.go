@@ -23,9 +23,12 @@ import (
 	"fmt"
 	"github.com/Shopify/sarama"
 	metrics "github.com/rcrowley/go-metrics"
+	"net"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,6 +45,25 @@ const (
 	ZookeeperOffsetStorage = "zookeeper"
 	// Kafka offset storage configuration string
 	KafkaOffsetStorage = "kafka"
+
+	// Commit processed offsets every OffsetCommitInterval
+	IntervalCommit = "interval"
+	// Commit processed offsets after each batch before accepting the next one
+	BatchCommit = "batch"
+	// Commit offsets only with Consumer.Commit and Consumer.CommitPartition
+	ManualCommit = "manual"
+
+	// Keep processing a partition if its offsets could not be committed
+	ContinueOnCommitFailure = "continue"
+	// Pause fetching a partition if its offsets could not be committed
+	PauseOnCommitFailure = "pause"
+	// Close the consumer if offsets of any partition could not be committed
+	CloseOnCommitFailure = "close"
+
+	// Release all partitions on every rebalance and claim the whole new assignment
+	EagerRebalance = "eager"
+	// Release only partitions that move to other consumers and claim only partitions that are new to this consumer
+	IncrementalRebalance = "incremental"
 )
 
 // Consumer is a high-level Kafka consumer designed to work within a consumer group.
@@ -52,6 +74,7 @@ type Consumer struct {
 	unsubscribe                    chan bool
 	unsubscribeFinished            chan bool
 	closeFinished                  chan bool
+	closeOnce                      sync.Once
 	rebalanceLock                  sync.Mutex
 	isShuttingdown                 bool
 	topicPartitionsAndBuffers      map[TopicAndPartition]*messageBuffer
@@ -61,6 +84,7 @@ type Consumer struct {
 	workerManagers                 map[TopicAndPartition]*WorkerManager
 	workerManagersLock             sync.Mutex
 	askNextBatch                   chan TopicAndPartition
+	seekGeneration                 int32
 	stopStreams                    chan bool
 
 	numWorkerManagersGauge            metrics.Gauge
@@ -69,19 +93,35 @@ type Consumer struct {
 	pendingWMsTasksCounter            metrics.Counter
 	wmsBatchDurationTimer             metrics.Timer
 	wmsIdleTimer                      metrics.Timer
+	metricNames                       map[string]bool
+	metricNamesLock                   sync.Mutex
+
+	messages        chan *Message
+	messagesLock    sync.RWMutex
+	messagesStop    chan bool
+	pendingAcks     map[TaskId]chan WorkerResult
+	pendingAcksLock sync.Mutex
 
 	newDeployedTopics []*DeployedTopics
+
+	adminListener net.Listener
+
+	//clients created by NewConsumer, which are closed along with the consumer. Clients set in ConsumerConfig belong to the caller and are left open.
+	createdOffsetStore OffsetStore
+	createdProducer    *KafkaProducer
 }
 
-/* NewConsumer creates a new Consumer with a given configuration. Creating a Consumer does not start fetching immediately. */
+/* NewConsumer creates a new Consumer with a given configuration. Creating a Consumer does not start fetching immediately.
+The Consumer works on its own copy of the configuration, so entries it fills in are not written back and the configuration may be reused for other consumers. */
 func NewConsumer(config *ConsumerConfig) *Consumer {
 	if err := config.Validate(); err != nil {
 		panic(err)
 	}
 
 	Infof(config.Consumerid, "Creating new consumer with configuration: %s", config)
+	consumerConfig := *config
 	c := &Consumer{
-		config:                         config,
+		config:                         &consumerConfig,
 		unsubscribe:                    make(chan bool),
 		unsubscribeFinished:            make(chan bool),
 		closeFinished:                  make(chan bool),
@@ -92,19 +132,55 @@ func NewConsumer(config *ConsumerConfig) *Consumer {
 		workerManagers:                 make(map[TopicAndPartition]*WorkerManager),
 		askNextBatch:                   make(chan TopicAndPartition),
 		stopStreams:                    make(chan bool),
+		metricNames:                    make(map[string]bool),
+	}
+	if c.config.MetricsRegistry == nil {
+		c.config.MetricsRegistry = metrics.NewRegistry()
+	}
+	if c.config.OffsetStore == nil {
+		c.createdOffsetStore = newDefaultOffsetStore(c.config)
+		c.config.OffsetStore = c.createdOffsetStore
+	}
+	if c.config.PullMode {
+		c.messages = make(chan *Message)
+		c.messagesStop = make(chan bool)
+		c.pendingAcks = make(map[TaskId]chan WorkerResult)
+		//WorkerManagers of this consumer get its own copy of the config, so messages of this consumer go to its Messages() only
+		c.config.Strategy = c.pullStrategy
 	}
 
 	if err := c.config.Coordinator.Connect(); err != nil {
 		panic(err)
 	}
+	needsDeadLetterProducer := c.config.DeadLetterTopic != "" && c.config.DeadLetterProducer == nil
+	needsRetryProducer := len(c.config.RetryTopicDelays) > 0 && c.config.RetryProducer == nil
+	if needsDeadLetterProducer || needsRetryProducer {
+		producer, err := c.newProducer()
+		if err != nil {
+			panic(err)
+		}
+		c.createdProducer = producer
+		if needsDeadLetterProducer {
+			c.config.DeadLetterProducer = producer
+		}
+		if needsRetryProducer {
+			c.config.RetryProducer = producer
+		}
+	}
 	c.fetcher = newConsumerFetcherManager(c.config, c.askNextBatch, newBarrier(int32(c.config.NumConsumerFetchers), c.applyNewDeployedTopics))
 
-	c.numWorkerManagersGauge = metrics.NewRegisteredGauge(fmt.Sprintf("NumWorkerManagers-%s", c.String()), metrics.DefaultRegistry)
-	c.batchesSentToWorkerManagerCounter = metrics.NewRegisteredCounter(fmt.Sprintf("BatchesSentToWM-%s", c.String()), metrics.DefaultRegistry)
-	c.activeWorkersCounter = metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", c.String()), metrics.DefaultRegistry)
-	c.pendingWMsTasksCounter = metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", c.String()), metrics.DefaultRegistry)
-	c.wmsBatchDurationTimer = metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", c.String()), metrics.DefaultRegistry)
-	c.wmsIdleTimer = metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", c.String()), metrics.DefaultRegistry)
+	c.numWorkerManagersGauge = metrics.NewRegisteredGauge(c.metricName("NumWorkerManagers", nil), c.config.MetricsRegistry)
+	c.batchesSentToWorkerManagerCounter = metrics.NewRegisteredCounter(c.metricName("BatchesSentToWM", nil), c.config.MetricsRegistry)
+	c.activeWorkersCounter = metrics.NewRegisteredCounter(c.metricName("WMsActiveWorkers", nil), c.config.MetricsRegistry)
+	c.pendingWMsTasksCounter = metrics.NewRegisteredCounter(c.metricName("WMsPendingTasks", nil), c.config.MetricsRegistry)
+	c.wmsBatchDurationTimer = metrics.NewRegisteredTimer(c.metricName("WMsBatchDuration", nil), c.config.MetricsRegistry)
+	c.wmsIdleTimer = metrics.NewRegisteredTimer(c.metricName("WMsIdleTime", nil), c.config.MetricsRegistry)
+
+	if c.config.AdminAddr != "" {
+		if err := c.startAdmin(); err != nil {
+			panic(err)
+		}
+	}
 
 	return c
 }
@@ -113,9 +189,19 @@ func (c *Consumer) String() string {
 	return c.config.Consumerid
 }
 
-/* Starts consuming specified topics using a configured amount of goroutines for each topic. */
+func (c *Consumer) newProducer() (*KafkaProducer, error) {
+	producerConfig := DefaultProducerConfig()
+	producerConfig.Clientid = c.config.Clientid
+	producerConfig.SocketTimeout = c.config.SocketTimeout
+	producerConfig.Coordinator = c.config.Coordinator
+
+	return NewKafkaProducer(producerConfig)
+}
+
+/* Starts consuming specified topics using a configured amount of goroutines for each topic.
+Retry topics for ConsumerConfig.RetryTopicDelays are consumed along with the specified topics. */
 func (c *Consumer) StartStatic(topicCountMap map[string]int) {
-	go c.createMessageStreams(topicCountMap)
+	go c.createMessageStreams(c.withRetryTopics(topicCountMap))
 
 	c.startStreams()
 }
@@ -138,7 +224,7 @@ func (c *Consumer) StartStaticPartitions(topicPartitionMap map[string][]int32) {
 		TopicsToNumStreamsMap: topicsToNumStreamsMap,
 	}
 
-	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount)
+	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount, c.config.AssignmentWeight, c.config.AssignmentTags)
 
 	time.Sleep(c.config.DeploymentTimeout)
 
@@ -162,7 +248,10 @@ func (c *Consumer) StartStaticPartitions(topicPartitionMap map[string][]int32) {
 
 	if c.reflectPartitionOwnershipDecision(partitionOwnershipDecision) {
 		c.initializeWorkerManagers()
-		go c.updateFetcher(c.config.NumConsumerFetchers)
+		go func() {
+			c.updateFetcher(c.config.NumConsumerFetchers)
+			c.partitionsAssigned()
+		}()
 	} else {
 		panic("Could not reflect partition ownership")
 	}
@@ -222,13 +311,25 @@ func (c *Consumer) disconnectChannels(stopRedirects map[TopicAndPartition]chan b
 	}
 }
 
+func (c *Consumer) withRetryTopics(topicCountMap map[string]int) map[string]int {
+	topics := make(map[string]int)
+	for topic, numStreams := range topicCountMap {
+		topics[topic] = numStreams
+		for _, delay := range c.config.RetryTopicDelays {
+			topics[RetryTopic(topic, delay)] = numStreams
+		}
+	}
+
+	return topics
+}
+
 func (c *Consumer) createMessageStreams(topicCountMap map[string]int) {
 	topicCount := &StaticTopicsToNumStreams{
 		ConsumerId:            c.config.Consumerid,
 		TopicsToNumStreamsMap: topicCountMap,
 	}
 
-	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount)
+	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount, c.config.AssignmentWeight, c.config.AssignmentTags)
 
 	time.Sleep(c.config.DeploymentTimeout)
 
@@ -244,7 +345,7 @@ func (c *Consumer) createMessageStreamsByFilterN(topicFilter TopicFilter, numStr
 		ExcludeInternalTopics: c.config.ExcludeInternalTopics,
 	}
 
-	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount)
+	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount, c.config.AssignmentWeight, c.config.AssignmentTags)
 
 	time.Sleep(c.config.DeploymentTimeout)
 
@@ -269,10 +370,14 @@ func (c *Consumer) initializeWorkerManagers() {
 				workerManager, exists := c.workerManagers[topicPartition]
 				if !exists {
 					workerManager = NewWorkerManager(fmt.Sprintf("WM-%s-%d", topic, partition), c.config, topicPartition, c.wmsIdleTimer,
-						c.wmsBatchDurationTimer, c.activeWorkersCounter, c.pendingWMsTasksCounter)
+						c.wmsBatchDurationTimer, c.activeWorkersCounter, c.pendingWMsTasksCounter, c.newPartitionMetrics(topicPartition))
+					workerManager.commitFailed = c.handleCommitFailure
 					c.workerManagers[topicPartition] = workerManager
+					c.registerLagGauges(topicPartition, workerManager)
+					go workerManager.Start()
+				} else {
+					workerManager.restart()
 				}
-				go workerManager.Start()
 			}
 		}
 		c.removeObsoleteWorkerManagers()
@@ -300,15 +405,238 @@ func (c *Consumer) removeObsoleteWorkerManagers() {
 		case <-time.After(5 * time.Second):
 		}
 		delete(c.workerManagers, tp)
+		c.unregisterPartitionMetrics(tp)
+	}
+}
+
+// Returns lag for a given topic-partition consumed by a given WorkerManager.
+func (c *Consumer) partitionLag(topicPartition TopicAndPartition, workerManager *WorkerManager) *PartitionLag {
+	return NewPartitionLag(c.fetcher.highWatermark(topicPartition), workerManager.GetLastCommittedOffset(), workerManager.GetLargestOffset())
+}
+
+// Metrics registered for each topic-partition owned by this consumer.
+var partitionMetricNames = []string{"CommitLag", "ProcessingLag", "MessagesProcessed", "BytesProcessed", "ProcessingFailures", "ProcessingLatency"}
+
+func (c *Consumer) registerLagGauges(topicPartition TopicAndPartition, workerManager *WorkerManager) {
+	c.config.MetricsRegistry.Register(c.metricName("CommitLag", &topicPartition), &lagGauge{func() int64 {
+		return c.partitionLag(topicPartition, workerManager).CommitLag
+	}})
+	c.config.MetricsRegistry.Register(c.metricName("ProcessingLag", &topicPartition), &lagGauge{func() int64 {
+		return c.partitionLag(topicPartition, workerManager).ProcessingLag
+	}})
+}
+
+// Creates PartitionMetrics for a given topic-partition registered in this consumer's MetricsRegistry.
+func (c *Consumer) newPartitionMetrics(topicPartition TopicAndPartition) *PartitionMetrics {
+	c.unregisterPartitionMetrics(topicPartition)
+	return &PartitionMetrics{
+		Messages: metrics.NewRegisteredMeter(c.metricName("MessagesProcessed", &topicPartition), c.config.MetricsRegistry),
+		Bytes:    metrics.NewRegisteredMeter(c.metricName("BytesProcessed", &topicPartition), c.config.MetricsRegistry),
+		Failures: metrics.NewRegisteredMeter(c.metricName("ProcessingFailures", &topicPartition), c.config.MetricsRegistry),
+		Latency:  metrics.NewRegisteredTimer(c.metricName("ProcessingLatency", &topicPartition), c.config.MetricsRegistry),
+	}
+}
+
+func (c *Consumer) unregisterPartitionMetrics(topicPartition TopicAndPartition) {
+	for _, name := range partitionMetricNames {
+		c.unregisterMetric(formatMetricName(name, c.String(), &topicPartition))
+	}
+}
+
+// Returns a name to register a metric of this consumer with, e.g. FetchDuration-<consumerid> or CommitLag-<consumerid>-<topic>-<partition> if topicPartition is not nil.
+// The metric is labeled with this consumer's id, group and topic-partition and is unregistered once this consumer is closed.
+func (c *Consumer) metricName(name string, topicPartition *TopicAndPartition) string {
+	registeredName := formatMetricName(name, c.String(), topicPartition)
+	inLock(&c.metricNamesLock, func() {
+		c.metricNames[registeredName] = true
+	})
+	return LabelMetric(registeredName, name, consumerMetricLabels(c.config, topicPartition))
+}
+
+func (c *Consumer) unregisterMetric(registeredName string) {
+	c.config.MetricsRegistry.Unregister(registeredName)
+	UnlabelMetric(registeredName)
+	inLock(&c.metricNamesLock, func() {
+		delete(c.metricNames, registeredName)
+	})
+}
+
+// Unregisters all metrics registered by this consumer.
+func (c *Consumer) unregisterMetrics() {
+	registeredNames := make([]string, 0)
+	inLock(&c.metricNamesLock, func() {
+		for registeredName := range c.metricNames {
+			registeredNames = append(registeredNames, registeredName)
+		}
+	})
+	for _, registeredName := range registeredNames {
+		c.unregisterMetric(registeredName)
+	}
+}
+
+// Stops fetching new messages for given partitions, or for all partitions if none are given, while keeping partition ownership and WorkerManagers.
+// Messages that are already fetched are still processed and committed. Partitions may be paused before they are assigned and stay paused across rebalances.
+func (c *Consumer) Pause(topicPartitions ...TopicAndPartition) {
+	if len(topicPartitions) == 0 {
+		Info(c, "Pausing consumer")
+	} else {
+		Infof(c, "Pausing partitions %v", topicPartitions)
+	}
+	c.fetcher.pause(topicPartitions...)
+}
+
+// Resumes fetching messages for given partitions, or for all partitions including the ones paused separately if none are given.
+// Resuming a partition while the whole consumer is paused takes effect once the consumer is resumed.
+func (c *Consumer) Resume(topicPartitions ...TopicAndPartition) {
+	if len(topicPartitions) == 0 {
+		Info(c, "Resuming consumer")
+	} else {
+		Infof(c, "Resuming partitions %v", topicPartitions)
+	}
+	c.fetcher.resume(topicPartitions...)
+}
+
+// Returns true if this consumer is paused for all partitions.
+func (c *Consumer) IsPaused() bool {
+	return c.fetcher.isPaused()
+}
+
+// Returns partitions that are not fetched, sorted by topic and partition.
+// These are the partitions paused separately and, if the whole consumer is paused, all owned partitions.
+func (c *Consumer) Paused() []TopicAndPartition {
+	paused := make(map[TopicAndPartition]bool)
+	for _, topicPartition := range c.fetcher.pausedTopicPartitions() {
+		paused[topicPartition] = true
+	}
+	if c.fetcher.isPaused() {
+		inLock(&c.workerManagersLock, func() {
+			for topicPartition := range c.workerManagers {
+				paused[topicPartition] = true
+			}
+		})
+	}
+
+	topicPartitions := make([]TopicAndPartition, 0, len(paused))
+	for topicPartition := range paused {
+		topicPartitions = append(topicPartitions, topicPartition)
+	}
+	sort.Sort(byTopicAndPartition(topicPartitions))
+	return topicPartitions
+}
+
+// Repositions a given partition owned by this consumer so that the next processed message is the one at a given offset.
+// Messages buffered for the partition are dropped, and messages fetched before the seek are not processed anymore except for the ones workers are already processing.
+// The offset right before the given one is committed immediately so the new position is kept if the consumer restarts.
+// Returns an error if the partition is not owned by this consumer or the new position could not be committed.
+func (c *Consumer) Seek(topicPartition TopicAndPartition, offset int64) error {
+	var workerManager *WorkerManager
+	inLock(&c.workerManagersLock, func() {
+		workerManager = c.workerManagers[topicPartition]
+	})
+	if workerManager == nil {
+		return fmt.Errorf("Partition %s is not owned by consumer %s", &topicPartition, c)
+	}
+
+	Infof(c, "Seeking %s to offset %d", &topicPartition, offset)
+	generation := atomic.AddInt32(&c.seekGeneration, 1)
+	//worker manager goes first so that it never drops messages fetched after the seek
+	if err := workerManager.seek(offset, generation); err != nil {
+		return err
 	}
+	return c.fetcher.seek(topicPartition, offset, generation)
+}
+
+// Repositions a given partition owned by this consumer to the earliest offset available in Kafka, see Seek.
+func (c *Consumer) SeekToBeginning(topicPartition TopicAndPartition) error {
+	return c.seekToTime(topicPartition, sarama.EarliestOffset)
+}
+
+// Repositions a given partition owned by this consumer to the offset of the next message produced to it, skipping all messages available in Kafka, see Seek.
+func (c *Consumer) SeekToEnd(topicPartition TopicAndPartition) error {
+	return c.seekToTime(topicPartition, sarama.LatestOffsets)
+}
+
+// Repositions a given partition owned by this consumer to messages produced around a given time, e.g. to replay the last 2 hours after an incident, see Seek.
+// As with ConsumerConfig.StartFromTime, consuming may start some time earlier than requested because Kafka resolves times to log segment boundaries.
+func (c *Consumer) SeekToTime(topicPartition TopicAndPartition, t time.Time) error {
+	return c.seekToTime(topicPartition, offsetTimeOf(t))
+}
+
+func (c *Consumer) seekToTime(topicPartition TopicAndPartition, offsetTime sarama.OffsetTime) error {
+	offset, err := c.offsetForTime(topicPartition, offsetTime)
+	if err != nil {
+		return err
+	}
+	return c.Seek(topicPartition, offset)
+}
+
+// Asks Kafka for the offset of a given partition at a given time.
+func (c *Consumer) offsetForTime(topicPartition TopicAndPartition, offsetTime sarama.OffsetTime) (int64, error) {
+	brokers, err := c.config.Coordinator.GetAllBrokers()
+	if err != nil {
+		return InvalidOffset, err
+	}
+	brokerList := make([]string, 0, len(brokers))
+	for _, broker := range brokers {
+		brokerList = append(brokerList, fmt.Sprintf("%s:%d", broker.Host, broker.Port))
+	}
+
+	client, err := sarama.NewClient(c.config.Clientid, brokerList, nil)
+	if err != nil {
+		return InvalidOffset, err
+	}
+	defer client.Close()
+
+	return getOffset(client, &topicPartition, offsetTime)
+}
+
+// Commits offsets of all messages processed so far for all partitions owned by this consumer and blocks until they are committed.
+// Returns the first error that occurred if some offsets could not be committed after ConsumerConfig.OffsetsCommitMaxRetries retries.
+func (c *Consumer) Commit() error {
+	workerManagers := make(map[TopicAndPartition]*WorkerManager)
+	inLock(&c.workerManagersLock, func() {
+		for topicPartition, workerManager := range c.workerManagers {
+			workerManagers[topicPartition] = workerManager
+		}
+	})
+
+	var commitErr error
+	for topicPartition, workerManager := range workerManagers {
+		if err := workerManager.commitOffset(); err != nil && commitErr == nil {
+			commitErr = fmt.Errorf("Failed to commit offset for %s: %s", &topicPartition, err)
+		}
+	}
+	return commitErr
+}
+
+// Commits a given offset for a given partition owned by this consumer, meaning that all messages up to and including this offset are processed,
+// regardless of which messages the consumer has actually processed. Blocks until the offset is committed.
+// Returns an error if the partition is not owned by this consumer or the offset could not be committed after ConsumerConfig.OffsetsCommitMaxRetries retries.
+func (c *Consumer) CommitPartition(topicPartition TopicAndPartition, offset int64) error {
+	var workerManager *WorkerManager
+	inLock(&c.workerManagersLock, func() {
+		workerManager = c.workerManagers[topicPartition]
+	})
+	if workerManager == nil {
+		return fmt.Errorf("Partition %s is not owned by consumer %s", &topicPartition, c)
+	}
+
+	return workerManager.commit(offset)
 }
 
 // Tells the Consumer to close all existing connections and stop.
-// This method is NOT blocking but returns a channel which will get a single value once the closing is finished.
+// This method is NOT blocking but returns a channel which is closed once the closing is finished.
+// Closing a Consumer that is already closing or closed returns the same channel.
 func (c *Consumer) Close() <-chan bool {
+	c.closeOnce.Do(c.startClosing)
+	return c.closeFinished
+}
+
+func (c *Consumer) startClosing() {
 	Info(c, "Consumer closing started...")
 	c.isShuttingdown = true
 	go func() {
+		c.stopAdmin()
 		c.unsubscribeFromChanges()
 
 		Info(c, "Closing fetcher manager...")
@@ -317,15 +645,49 @@ func (c *Consumer) Close() <-chan bool {
 		if !c.stopWorkerManagers() {
 			panic("Graceful shutdown failed")
 		}
+		if c.config.PullMode {
+			c.closeMessages()
+		}
+		c.closeCreatedClients()
+
+		c.unregisterMetrics()
 
 		c.stopStreams <- true
-		c.closeFinished <- true
+		close(c.closeFinished)
 	}()
-	return c.closeFinished
+}
+
+// Closes clients created by NewConsumer. Clients set in ConsumerConfig may be used by the application or other consumers, so they are left open.
+func (c *Consumer) closeCreatedClients() {
+	if c.createdOffsetStore != nil {
+		if err := c.createdOffsetStore.Close(); err != nil {
+			Warnf(c, "Failed to close offset store: %s", err)
+		}
+	}
+	if c.createdProducer != nil {
+		if err := c.createdProducer.Close(); err != nil {
+			Warnf(c, "Failed to close producer: %s", err)
+		}
+	}
+}
+
+// Applies ConsumerConfig.CommitFailurePolicy once offsets of a given partition could not be committed after all retries.
+func (c *Consumer) handleCommitFailure(topicPartition TopicAndPartition) {
+	switch c.config.CommitFailurePolicy {
+	case PauseOnCommitFailure:
+		Errorf(c, "Pausing %s as its offsets could not be committed", &topicPartition)
+		c.Pause(topicPartition)
+	case CloseOnCommitFailure:
+		Errorf(c, "Closing consumer as offsets of %s could not be committed", &topicPartition)
+		c.Close()
+	}
 }
 
 func (c *Consumer) applyNewDeployedTopics() {
 	inLock(&c.rebalanceLock, func() {
+		if !c.revokePartitions(c.ownedTopicPartitions()) {
+			panic("Failed to revoke partitions before switching to new deployed topic")
+		}
 		Debug(c, "Releasing parition ownership")
 		c.releasePartitionOwnership(c.topicRegistry)
 		Debug(c, "Released parition ownership")
@@ -348,12 +710,16 @@ func (c *Consumer) applyNewDeployedTopics() {
 			panic(err)
 		}
 
-		c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount)
+		c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, topicCount, c.config.AssignmentWeight, c.config.AssignmentTags)
 		consumersInGroup, err := c.config.Coordinator.GetConsumersInGroup(c.config.Groupid)
 		if err != nil {
 			panic(err)
 		}
 		assignmentContext := newStaticAssignmentContext(c.config.Groupid, c.config.Consumerid, consumersInGroup, topicCount, topicPartitionMap)
+		assignmentContext.ConsumerInfos, err = getConsumerInfos(c.config.Groupid, consumersInGroup, c.config.Coordinator)
+		if err != nil {
+			panic(err)
+		}
 		partitionAssignor := newPartitionAssignor(c.config.PartitionAssignmentStrategy)
 		partitionOwnershipDecision := partitionAssignor(assignmentContext)
 		topicPartitions := make([]*TopicAndPartition, 0)
@@ -369,6 +735,7 @@ func (c *Consumer) applyNewDeployedTopics() {
 		if c.reflectPartitionOwnershipDecision(partitionOwnershipDecision) {
 			c.topicRegistry = currentTopicRegistry
 			c.initFetchersAndWorkers(assignmentContext)
+			c.partitionsAssigned()
 			c.newDeployedTopics = append(c.newDeployedTopics[:0], c.newDeployedTopics[1:]...)
 		} else {
 			panic("Failed to switch to new deployed topic")
@@ -391,6 +758,9 @@ func (c *Consumer) stopWorkerManagers() bool {
 			case <-wmsAreStopped:
 				{
 					Info(c, "All workers have been gracefully stopped")
+					for topicPartition := range c.workerManagers {
+						c.unregisterPartitionMetrics(topicPartition)
+					}
 					c.workerManagers = make(map[TopicAndPartition]*WorkerManager)
 					success = true
 				}
@@ -531,6 +901,7 @@ func (c *Consumer) unsubscribeFromChanges() {
 	c.unsubscribe <- true
 	coordinator := c.config.Coordinator
 	coordinator.Unsubscribe()
+	c.revokePartitions(c.ownedTopicPartitions())
 	c.releasePartitionOwnership(c.topicRegistry)
 	coordinator.DeregisterConsumer(c.config.Consumerid, c.config.Groupid)
 }
@@ -564,6 +935,13 @@ func tryRebalance(c *Consumer, partitionAssignor assignStrategy) bool {
 		return false
 	}
 	Infof(c, "%v\n", brokers)
+	if c.rebalancesIncrementally() {
+		return tryIncrementalRebalance(c, partitionAssignor)
+	}
+
+	if !c.revokePartitions(c.ownedTopicPartitions()) {
+		return false
+	}
 	c.releasePartitionOwnership(c.topicRegistry)
 
 	assignmentContext, err := newAssignmentContext(c.config.Groupid, c.config.Consumerid, c.config.ExcludeInternalTopics, c.config.Coordinator)
@@ -600,6 +978,7 @@ func tryRebalance(c *Consumer, partitionAssignor assignStrategy) bool {
 	if c.reflectPartitionOwnershipDecision(partitionOwnershipDecision) {
 		c.topicRegistry = currenttopicRegistry
 		c.initFetchersAndWorkers(assignmentContext)
+		c.partitionsAssigned()
 	} else {
 		Errorf(c, "Failed to reflect partition ownership during rebalance")
 		return false
@@ -608,7 +987,118 @@ func tryRebalance(c *Consumer, partitionAssignor assignStrategy) bool {
 	return true
 }
 
-func (c *Consumer) initFetchersAndWorkers(assignmentContext *assignmentContext) {
+// Sticky assignment keeps partitions with their current owners, which are all released before the assignment is computed with EagerRebalance,
+// so consumers using StickyStrategy rebalance incrementally regardless of RebalanceProtocol.
+func (c *Consumer) rebalancesIncrementally() bool {
+	return c.config.RebalanceProtocol == IncrementalRebalance || c.config.PartitionAssignmentStrategy == StickyStrategy
+}
+
+// Rebalances only partitions whose ownership changes. Partitions assigned to other consumers are revoked, stop being fetched and processed and only then are released,
+// partitions new to this consumer are claimed, while fetchers and WorkerManagers of retained partitions keep running all the time.
+// Partitions that could not be claimed because their previous owner did not release them yet are claimed on the next retry.
+func tryIncrementalRebalance(c *Consumer, partitionAssignor assignStrategy) bool {
+	assignmentContext, err := newAssignmentContext(c.config.Groupid, c.config.Consumerid, c.config.ExcludeInternalTopics, c.config.Coordinator)
+	if err != nil {
+		Errorf(c, "Failed to initialize assignment context: %s", err)
+		return false
+	}
+
+	partitionOwnershipDecision := partitionAssignor(assignmentContext)
+	revokedPartitions, newPartitionOwnershipDecision := ownershipChanges(c.topicRegistry, partitionOwnershipDecision)
+	Infof(c, "Revoking partitions %v, claiming partitions %v\n", revokedPartitions, newPartitionOwnershipDecision)
+
+	if len(revokedPartitions) > 0 {
+		if !c.revokePartitions(revokedPartitions) {
+			return false
+		}
+		retainedTopicRegistry := copyTopicRegistry(c.topicRegistry)
+		revokedTopicRegistry := make(map[string]map[int32]*partitionTopicInfo)
+		for _, topicPartition := range revokedPartitions {
+			if _, exists := revokedTopicRegistry[topicPartition.Topic]; !exists {
+				revokedTopicRegistry[topicPartition.Topic] = make(map[int32]*partitionTopicInfo)
+			}
+			revokedTopicRegistry[topicPartition.Topic][topicPartition.Partition] = retainedTopicRegistry[topicPartition.Topic][topicPartition.Partition]
+			delete(retainedTopicRegistry[topicPartition.Topic], topicPartition.Partition)
+			if len(retainedTopicRegistry[topicPartition.Topic]) == 0 {
+				delete(retainedTopicRegistry, topicPartition.Topic)
+			}
+		}
+		c.topicRegistry = retainedTopicRegistry
+		c.initFetchersAndWorkers(assignmentContext)
+		c.releasePartitionOwnership(revokedTopicRegistry)
+	}
+
+	topicPartitions := make([]*TopicAndPartition, 0)
+	for topicPartition := range newPartitionOwnershipDecision {
+		topicPartitions = append(topicPartitions, &TopicAndPartition{topicPartition.Topic, topicPartition.Partition})
+	}
+
+	offsetsFetchResponse, err := c.fetchOffsets(topicPartitions)
+	if err != nil {
+		Errorf(c, "Failed to fetch offsets during rebalance: %s", err)
+		return false
+	}
+
+	if c.isShuttingdown {
+		Warnf(c, "Aborting consumer '%s' rebalancing, since shutdown sequence started.", c.config.Consumerid)
+		return true
+	}
+
+	if !c.reflectPartitionOwnershipDecision(newPartitionOwnershipDecision) {
+		Errorf(c, "Failed to reflect partition ownership during rebalance")
+		return false
+	}
+
+	if len(topicPartitions) > 0 {
+		currentTopicRegistry := copyTopicRegistry(c.topicRegistry)
+		for _, topicPartition := range topicPartitions {
+			offset := offsetsFetchResponse.Blocks[topicPartition.Topic][topicPartition.Partition].Offset
+			threadId := newPartitionOwnershipDecision[*topicPartition]
+			c.addPartitionTopicInfo(currentTopicRegistry, topicPartition, offset, threadId)
+		}
+		c.topicRegistry = currentTopicRegistry
+		c.initFetchersAndWorkers(assignmentContext)
+	}
+	c.partitionsAssigned()
+
+	return true
+}
+
+// Compares partitions in a given topic registry with a new partition ownership decision.
+// Returns partitions that are not in the decision anymore sorted by topic and partition, and the part of the decision with partitions that are not in the topic registry yet.
+func ownershipChanges(topicRegistry map[string]map[int32]*partitionTopicInfo, partitionOwnershipDecision map[TopicAndPartition]ConsumerThreadId) ([]TopicAndPartition, map[TopicAndPartition]ConsumerThreadId) {
+	revokedPartitions := make([]TopicAndPartition, 0)
+	for topic, partitions := range topicRegistry {
+		for partition := range partitions {
+			if _, exists := partitionOwnershipDecision[TopicAndPartition{topic, partition}]; !exists {
+				revokedPartitions = append(revokedPartitions, TopicAndPartition{topic, partition})
+			}
+		}
+	}
+	sort.Sort(byTopicAndPartition(revokedPartitions))
+
+	newPartitionOwnershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
+	for topicPartition, consumerThreadId := range partitionOwnershipDecision {
+		if _, exists := topicRegistry[topicPartition.Topic][topicPartition.Partition]; !exists {
+			newPartitionOwnershipDecision[topicPartition] = consumerThreadId
+		}
+	}
+
+	return revokedPartitions, newPartitionOwnershipDecision
+}
+
+func copyTopicRegistry(topicRegistry map[string]map[int32]*partitionTopicInfo) map[string]map[int32]*partitionTopicInfo {
+	registryCopy := make(map[string]map[int32]*partitionTopicInfo)
+	for topic, partitions := range topicRegistry {
+		registryCopy[topic] = make(map[int32]*partitionTopicInfo)
+		for partition, info := range partitions {
+			registryCopy[topic][partition] = info
+		}
+	}
+	return registryCopy
+}
+
+func (c *Consumer) initFetchersAndWorkers(assignmentContext *AssignmentContext) {
 	switch topicCount := assignmentContext.MyTopicToNumStreams.(type) {
 	case *StaticTopicsToNumStreams:
 		{
@@ -632,25 +1122,21 @@ func (c *Consumer) fetchOffsets(topicPartitions []*TopicAndPartition) (*sarama.O
 		return &sarama.OffsetFetchResponse{}, nil
 	} else {
 		blocks := make(map[string]map[int32]*sarama.OffsetFetchResponseBlock)
-		if c.config.OffsetsStorage == "zookeeper" {
-			for _, topicPartition := range topicPartitions {
-				offset, err := c.config.Coordinator.GetOffsetForTopicPartition(c.config.Groupid, topicPartition)
-				_, exists := blocks[topicPartition.Topic]
-				if !exists {
-					blocks[topicPartition.Topic] = make(map[int32]*sarama.OffsetFetchResponseBlock)
-				}
-				if err != nil {
-					return nil, err
-				} else {
-					blocks[topicPartition.Topic][int32(topicPartition.Partition)] = &sarama.OffsetFetchResponseBlock{
-						Offset:   offset,
-						Metadata: "",
-						Err:      sarama.NoError,
-					}
+		for _, topicPartition := range topicPartitions {
+			offset, err := c.config.OffsetStore.GetOffset(c.config.Groupid, topicPartition)
+			_, exists := blocks[topicPartition.Topic]
+			if !exists {
+				blocks[topicPartition.Topic] = make(map[int32]*sarama.OffsetFetchResponseBlock)
+			}
+			if err != nil {
+				return nil, err
+			} else {
+				blocks[topicPartition.Topic][int32(topicPartition.Partition)] = &sarama.OffsetFetchResponseBlock{
+					Offset:   offset,
+					Metadata: "",
+					Err:      sarama.NoError,
 				}
 			}
-		} else {
-			panic(fmt.Sprintf("Offset storage '%s' is not supported", c.config.OffsetsStorage))
 		}
 
 		return &sarama.OffsetFetchResponse{Blocks: blocks}, nil
@@ -710,6 +1196,66 @@ func (c *Consumer) reflectPartitionOwnershipDecision(partitionOwnershipDecision
 	return true
 }
 
+// A callback that is triggered with partitions a consumer loses or gets during a rebalance.
+type RebalanceCallback func(topicPartitions []TopicAndPartition)
+
+// Returns partitions in the topic registry of this consumer sorted by topic and partition.
+func (c *Consumer) ownedTopicPartitions() []TopicAndPartition {
+	topicPartitions := make([]TopicAndPartition, 0)
+	for topic, partitions := range c.topicRegistry {
+		for partition := range partitions {
+			topicPartitions = append(topicPartitions, TopicAndPartition{topic, partition})
+		}
+	}
+	sort.Sort(byTopicAndPartition(topicPartitions))
+	return topicPartitions
+}
+
+// Stops processing given partitions once their in-flight tasks are done and passes them to ConsumerConfig.OnPartitionsRevoked.
+// Should be called before partition ownership is released. Stopped WorkerManagers are started again if their partitions are assigned to this consumer again.
+// Returns false if WorkerManagers failed to stop within ConsumerConfig.WorkerManagersStopTimeout.
+func (c *Consumer) revokePartitions(topicPartitions []TopicAndPartition) bool {
+	if c.config.OnPartitionsRevoked == nil || len(topicPartitions) == 0 {
+		return true
+	}
+
+	wmStopChannels := make([]chan bool, 0)
+	inLock(&c.workerManagersLock, func() {
+		for _, topicPartition := range topicPartitions {
+			if wm, exists := c.workerManagers[topicPartition]; exists {
+				wmStopChannels = append(wmStopChannels, wm.Stop())
+			}
+		}
+	})
+	if len(wmStopChannels) > 0 {
+		wmsAreStopped := make(chan bool)
+		notifyWhenThresholdIsReached(wmStopChannels, wmsAreStopped, len(wmStopChannels))
+		select {
+		case <-wmsAreStopped:
+		case <-time.After(c.config.WorkerManagersStopTimeout):
+			{
+				Errorf(c, "Workers failed to stop whithin timeout of %s before revoking partitions", c.config.WorkerManagersStopTimeout)
+				return false
+			}
+		}
+	}
+
+	Infof(c, "Revoking partitions %v", topicPartitions)
+	c.config.OnPartitionsRevoked(topicPartitions)
+	return true
+}
+
+// Passes all partitions owned by this consumer to ConsumerConfig.OnPartitionsAssigned once fetchers and WorkerManagers for them are started.
+func (c *Consumer) partitionsAssigned() {
+	if c.config.OnPartitionsAssigned == nil {
+		return
+	}
+
+	topicPartitions := c.ownedTopicPartitions()
+	Infof(c, "Assigned partitions %v", topicPartitions)
+	c.config.OnPartitionsAssigned(topicPartitions)
+}
+
 func (c *Consumer) releasePartitionOwnership(localtopicRegistry map[string]map[int32]*partitionTopicInfo) {
 	Info(c, "Releasing partition ownership")
 	for topic, partitionInfos := range localtopicRegistry {
@@ -723,9 +1269,15 @@ func (c *Consumer) releasePartitionOwnership(localtopicRegistry map[string]map[i
 }
 
 // Returns a state snapshot for this consumer. State snapshot contains a set of metrics splitted by topics and partitions.
+// Only metrics of this consumer are included even if MetricsRegistry is shared with other consumers.
+// Consumer lag for each topic-partition is also registered as CommitLag-<consumerid>-<topic>-<partition> and ProcessingLag-<consumerid>-<topic>-<partition> gauges,
+// and messages, bytes, failures and processing latency as MessagesProcessed, BytesProcessed, ProcessingFailures meters and ProcessingLatency timer named the same way.
 func (c *Consumer) StateSnapshot() *StateSnapshot {
 	metricsMap := make(map[string]map[string]float64)
-	metrics.DefaultRegistry.Each(func(name string, metric interface{}) {
+	c.config.MetricsRegistry.Each(func(name string, metric interface{}) {
+		if metricLabels(name).Labels[ConsumerIdLabel] != c.config.Consumerid {
+			return
+		}
 		metricsMap[name] = make(map[string]float64)
 		switch entry := metric.(type) {
 		case metrics.Counter: {
@@ -775,9 +1327,19 @@ func (c *Consumer) StateSnapshot() *StateSnapshot {
 		offsetsMap[topicAndPartition.Topic][topicAndPartition.Partition] = workerManager.GetLargestOffset()
 	}
 
+	lagsMap := make(map[string]map[int32]*PartitionLag)
+	for topicAndPartition, workerManager := range c.workerManagers {
+		if _, exists := lagsMap[topicAndPartition.Topic]; !exists {
+			lagsMap[topicAndPartition.Topic] = make(map[int32]*PartitionLag)
+		}
+
+		lagsMap[topicAndPartition.Topic][topicAndPartition.Partition] = c.partitionLag(topicAndPartition, workerManager)
+	}
+
 	return &StateSnapshot{
 		Metrics: metricsMap,
 		Offsets: offsetsMap,
+		Lags:    lagsMap,
 	}
 }
 
@@ -18,8 +18,10 @@ package go_kafka_client
 import (
 	"errors"
 	"fmt"
+	metrics "github.com/rcrowley/go-metrics"
 	"time"
 	"strconv"
+	"strings"
 )
 
 //ConsumerConfig defines configuration options for Consumer
@@ -55,37 +57,100 @@ type ConsumerConfig struct {
 	/* Backoff time between retries during rebalance */
 	RebalanceBackoff time.Duration
 
+	/* How partitions are moved between consumers during rebalance:
+	IncrementalRebalance : release only partitions that are assigned to other consumers and claim only partitions that are new to this consumer.
+	Fetchers and WorkerManagers of partitions this consumer keeps are not stopped, so a consumer joining or leaving the group stalls only partitions that move.
+	EagerRebalance : release all partitions and claim the whole new assignment on every rebalance. Not used with StickyStrategy, which always rebalances incrementally.
+	Defaults to EagerRebalance. */
+	RebalanceProtocol string
+
 	/* Backoff time to refresh the leader of a partition after it loses the current leader */
 	RefreshLeaderBackoff time.Duration
 
-	/* Retry the offset commit up to this many times on failure. */
+	/* Retry the offset commit up to this many times on failure. Also limits offset fetch retries when OffsetsStorage is "kafka". */
 	OffsetsCommitMaxRetries int
 
+	/* Backoff before the first offset commit retry. The backoff is doubled after each failed retry. */
+	OffsetsCommitBackoff time.Duration
+
+	/* What to do once offsets of a partition could not be committed after OffsetsCommitMaxRetries retries:
+	ContinueOnCommitFailure : keep processing the partition, its offsets are committed again on the next commit.
+	PauseOnCommitFailure : pause fetching the partition until Consumer.Resume is called.
+	CloseOnCommitFailure : close the consumer, so that its partitions are taken over by the rest of the consumer group.
+	Applies only to offsets committed automatically, Consumer.Commit and Consumer.CommitPartition return errors instead.
+	Defaults to ContinueOnCommitFailure. */
+	CommitFailurePolicy string
+
+	/* A callback that is triggered during a rebalance before this consumer gives up ownership of its partitions, e.g. to flush and drop per-partition state.
+	It is called once WorkerManagers of these partitions have finished their in-flight tasks and committed their offsets, and no more messages of these partitions are processed until they are assigned again.
+	With IncrementalRebalance it gets only partitions that move to other consumers, with EagerRebalance all partitions this consumer owned.
+	It is also called when the consumer is closed. It should not block for long as the whole consumer group waits for the rebalance to finish. */
+	OnPartitionsRevoked RebalanceCallback
+
+	/* A callback that is triggered once a rebalance has finished with all partitions owned by this consumer, e.g. to initialize per-partition state or to Seek.
+	Partitions owned before the rebalance are reported again if this consumer still owns them. */
+	OnPartitionsAssigned RebalanceCallback
+
+	/* A callback that is triggered after each attempt to commit an offset of a partition (including all retries) with an error if the offset was not committed. */
+	OnCommit CommitCallback
+
 	/* Try to commit offset every OffsetCommitInterval. If previous offset commit for a partition is still in progress updates the next offset to commit and continues.
 	This way it does not commit all the offset history if the coordinator is slow, but only the highest offsets. */
 	OffsetCommitInterval time.Duration
 
-	/* Specify whether offsets should be committed to "zookeeper" (default) or "kafka". */
+	/* When offsets are committed:
+	IntervalCommit : commit processed offsets every OffsetCommitInterval.
+	BatchCommit : commit processed offsets right after each batch is processed and before the next batch is accepted.
+	ManualCommit : commit offsets only with Consumer.Commit and Consumer.CommitPartition. Offsets are not committed on rebalance or close either.
+	Defaults to IntervalCommit. */
+	OffsetCommitMode string
+
+	/* Specify whether offsets should be committed to "zookeeper" (default) or "kafka".
+	Kafka offset storage sends OffsetFetch and OffsetCommit requests to the offset manager broker of the consumer group.
+	Used only to create a default OffsetStore if OffsetStore is not set. */
 	OffsetsStorage string
 
+	/* Store used to fetch and commit offsets. If not set, NewConsumer creates ZookeeperOffsetStore or KafkaOffsetStore according to OffsetsStorage.
+	ZookeeperOffsetStore can be created this way only if Coordinator is a ZookeeperCoordinator. A store created by NewConsumer is closed along with the consumer,
+	while a store set here belongs to the caller and is left open. */
+	OffsetStore OffsetStore
+
 	/* What to do if an offset is out of range.
 	SmallestOffset : automatically reset the offset to the smallest offset.
 	LargestOffset : automatically reset the offset to the largest offset.
 	Defaults to LargestOffset. */
 	AutoOffsetReset string
 
+	/* If set, partitions that have no offset committed for this consumer group start from messages produced around this time instead of AutoOffsetReset.
+	Kafka resolves the time to the first offset of the log segment that was last modified before it, so consuming may start some time earlier than requested.
+	If all available messages were produced after this time, consuming starts from the smallest offset.
+	AutoOffsetReset is still used if an offset goes out of range later on. */
+	StartFromTime time.Time
+
 	/* Client id is specified by the kafka consumer client, used to distinguish different clients. */
 	Clientid string
 
 	/* Whether messages from internal topics (such as offsets) should be exposed to the consumer. */
 	ExcludeInternalTopics bool
 
-	/* Select a strategy for assigning partitions to consumer streams. Possible values: RangeStrategy, RoundRobinStrategy */
+	/* Select a strategy for assigning partitions to consumer streams. Possible values: RangeStrategy, RoundRobinStrategy, StickyStrategy, WeightedStrategy or a name of a PartitionAssignor registered with RegisterPartitionAssignor */
 	PartitionAssignmentStrategy string
 
+	/* Relative capacity of this consumer advertised to the consumer group, e.g. 2 on an instance twice as large as those with 1.
+	WeightedStrategy assigns partitions in proportion to it. Defaults to 1. */
+	AssignmentWeight int
+
+	/* Optional labels of this consumer (e.g. host or zone) advertised to the consumer group for custom partition assignors, see AssignmentContext.ConsumerInfos. */
+	AssignmentTags map[string]string
+
 	/* Amount of workers per partition to process consumed messages. */
 	NumWorkers int
 
+	/* Whether messages with the same key should be processed one by one in offset order.
+	When enabled, messages of a batch are split between workers by key, so each key is handled by a single worker while different keys are still processed in parallel.
+	Messages without key are spread between workers and are not ordered. */
+	KeyOrderedProcessing bool
+
 	/* Times to retry processing a failed message by a worker. */
 	MaxWorkerRetries int
 
@@ -102,6 +167,24 @@ type ConsumerConfig struct {
 	/* Callback executed when Worker failed to process the message after MaxWorkerRetries and WorkerRetryThreshold is not hit */
 	WorkerFailedAttemptCallback FailedAttemptCallback
 
+	/* Topic to send messages that failed to be processed to when a failure callback returns SendToDeadLetterTopicAndContinue.
+	Each message is wrapped into a DeadLetter envelope encoded as JSON. */
+	DeadLetterTopic string
+
+	/* Producer used to send messages to DeadLetterTopic. If not set and DeadLetterTopic is set, a KafkaProducer working with brokers registered in Coordinator is created
+	and closed along with the consumer. A producer set here belongs to the caller and is left open. */
+	DeadLetterProducer Producer
+
+	/* Delays of retry topics used when a failure callback returns SendToRetryTopicAndContinue, e.g. 1 minute and 10 minutes.
+	A message that failed to be processed is sent to "<topic>.retry.1m" first, then to "<topic>.retry.10m" and then to DeadLetterTopic if it is set.
+	Messages from retry topics are processed once their delay has passed without blocking the original topic.
+	Retry topics are consumed along with the original topics by StartStatic. When using StartWildcard make sure the filter matches retry topics too. */
+	RetryTopicDelays []time.Duration
+
+	/* Producer used to send messages to retry topics. If not set and RetryTopicDelays are set, a KafkaProducer working with brokers registered in Coordinator is created
+	(or shared with DeadLetterProducer if that one is created too) and closed along with the consumer. A producer set here belongs to the caller and is left open. */
+	RetryProducer Producer
+
 	/* Worker timeout to process a single message. */
 	WorkerTaskTimeout time.Duration
 
@@ -112,9 +195,26 @@ type ConsumerConfig struct {
 	WorkerManagersStopTimeout time.Duration
 
 	/* A function which defines a user-specified action on a single message. This function is responsible for actual message processing.
-	Consumer panics if Strategy is not set. */
+	Either Strategy or BatchStrategy must be set unless PullMode is enabled. */
 	Strategy WorkerStrategy
 
+	/* A function which defines a user-specified action on a whole batch of messages flushed to workers (see FetchBatchSize and FetchBatchTimeout).
+	When set, each batch is processed at once by a single worker and only failed messages are passed to the next attempt.
+	Either Strategy or BatchStrategy must be set unless PullMode is enabled. */
+	BatchStrategy BatchWorkerStrategy
+
+	/* If true, messages are not processed with a Strategy but delivered to Consumer.Messages(), and each of them should be acknowledged with Consumer.Ack or Consumer.Nack.
+	Acknowledged offsets are committed the same way as the ones processed by a Strategy, up to NumWorkers messages per partition are awaiting acknowledgement at once,
+	and messages not acknowledged within WorkerTaskTimeout are redelivered. Strategy is ignored and BatchStrategy cannot be used. */
+	PullMode bool
+
+	/* Decoder for message keys. If set, Message.DecodedKey is filled before a message is passed to Strategy or BatchStrategy. */
+	KeyDecoder Decoder
+
+	/* Decoder for message values. If set, Message.DecodedValue is filled before a message is passed to Strategy or BatchStrategy.
+	Messages that fail to be decoded are not retried and get a DecodingFailedResult passed to WorkerFailedAttemptCallback right away. */
+	ValueDecoder Decoder
+
 	/* Number of messages to accumulate before flushing them to workers */
 	FetchBatchSize int
 
@@ -141,12 +241,21 @@ type ConsumerConfig struct {
 	Coordinator ConsumerCoordinator
 
 	/* Indicates whether the client supports blue-green deployment.
-	This config entry is needed because blue-green deployment won't work with RoundRobin partition assignment strategy.
+	This config entry is needed because blue-green deployment works only with Range and Sticky partition assignment strategies.
 	Defaults to true. */
 	BlueGreenDeploymentEnabled bool
 
 	/* Time to wait after consumer has registered itself in group */
 	DeploymentTimeout time.Duration
+
+	/* Address in host:port format to serve the HTTP admin endpoint on (/state, /assignment, /config, /workers, /metrics, /pause and /resume).
+	The admin endpoint is disabled if empty. */
+	AdminAddr string
+
+	/* Registry to register all metrics of this consumer in. Metrics are unregistered once the consumer is closed.
+	A new registry is created for each consumer if not set, so set it to e.g. metrics.DefaultRegistry to report metrics of several consumers together.
+	Note that consumers used to register their metrics in metrics.DefaultRegistry, so reporters reading metrics.DefaultRegistry need it set here to keep working. */
+	MetricsRegistry metrics.Registry
 }
 
 //DefaultConsumerConfig creates a ConsumerConfig with sane defaults. Note that several required config entries (like Strategy and callbacks) are still not set.
@@ -161,15 +270,20 @@ func DefaultConsumerConfig() *ConsumerConfig {
 	config.FetchMinBytes = 1
 	config.FetchWaitMaxMs = 100
 	config.RebalanceBackoff = 5 * time.Second
+	config.RebalanceProtocol = EagerRebalance
 	config.RefreshLeaderBackoff = 200 * time.Millisecond
 	config.OffsetsCommitMaxRetries = 5
+	config.OffsetsCommitBackoff = 200 * time.Millisecond
+	config.CommitFailurePolicy = ContinueOnCommitFailure
 	config.OffsetCommitInterval = 3 * time.Second
+	config.OffsetCommitMode = IntervalCommit
 	config.OffsetsStorage = ZookeeperOffsetStorage
 
 	config.AutoOffsetReset = LargestOffset
 	config.Clientid = "go-client"
 	config.ExcludeInternalTopics = true
-	config.PartitionAssignmentStrategy = RangeStrategy /* select between "RangeStrategy", and "RoundRobinStrategy" */
+	config.PartitionAssignmentStrategy = RangeStrategy /* select between "RangeStrategy", "RoundRobinStrategy", "StickyStrategy" and "WeightedStrategy" */
+	config.AssignmentWeight = 1
 
 	config.NumWorkers = 10
 	config.MaxWorkerRetries = 3
@@ -205,36 +319,52 @@ RebalanceMaxRetries: %d
 FetchMinBytes: %d
 FetchWaitMaxMs: %d
 RebalanceBackoffMs: %d
+RebalanceProtocol: %s
 RefreshLeaderBackoff: %d
 OffsetsCommitMaxRetries: %d
 OffsetsStorage: %s
+OffsetCommitMode: %s
+OffsetsCommitBackoff: %v
+CommitFailurePolicy: %s
+OffsetStore: %v
 AutoOffsetReset: %s
+StartFromTime: %v
 ClientId: %s
 ConsumerId: %s
 ExcludeInternalTopics: %v
 PartitionAssignmentStrategy: %s
+AssignmentWeight: %d
+AssignmentTags: %v
 NumWorkers: %d
+KeyOrderedProcessing: %v
 MaxWorkerRetries: %d
 WorkerRetryThreshold %d
 WorkerThresholdTimeWindow %v
 WorkerFailureCallback %v
 WorkerFailedAttemptCallback %v
+DeadLetterTopic %s
+RetryTopicDelays %v
 WorkerTaskTimeout %v
 WorkerBackoff %v
 Strategy %v
+BatchStrategy %v
+PullMode %v
+KeyDecoder %v
+ValueDecoder %v
 FetchBatchSize %d
 FetchBatchTimeout %v
+AdminAddr %s
 `, c.Groupid, c.SocketTimeout,
 		c.FetchMessageMaxBytes, c.NumConsumerFetchers, c.QueuedMaxMessages, c.RebalanceMaxRetries,
 		c.FetchMinBytes, c.FetchWaitMaxMs,
-		c.RebalanceBackoff, c.RefreshLeaderBackoff,
-		c.OffsetsCommitMaxRetries, c.OffsetsStorage,
-		c.AutoOffsetReset, c.Clientid, c.Consumerid,
-		c.ExcludeInternalTopics, c.PartitionAssignmentStrategy, c.NumWorkers,
-		c.MaxWorkerRetries, c.WorkerRetryThreshold,
-		c.WorkerThresholdTimeWindow, c.WorkerFailureCallback, c.WorkerFailedAttemptCallback,
+		c.RebalanceBackoff, c.RebalanceProtocol, c.RefreshLeaderBackoff,
+		c.OffsetsCommitMaxRetries, c.OffsetsStorage, c.OffsetCommitMode, c.OffsetsCommitBackoff, c.CommitFailurePolicy, c.OffsetStore,
+		c.AutoOffsetReset, c.StartFromTime, c.Clientid, c.Consumerid,
+		c.ExcludeInternalTopics, c.PartitionAssignmentStrategy, c.AssignmentWeight, c.AssignmentTags, c.NumWorkers,
+		c.KeyOrderedProcessing, c.MaxWorkerRetries, c.WorkerRetryThreshold,
+		c.WorkerThresholdTimeWindow, c.WorkerFailureCallback, c.WorkerFailedAttemptCallback, c.DeadLetterTopic, c.RetryTopicDelays,
 		c.WorkerTaskTimeout, c.WorkerBackoff,
-		c.Strategy, c.FetchBatchSize, c.FetchBatchTimeout)
+		c.Strategy, c.BatchStrategy, c.PullMode, c.KeyDecoder, c.ValueDecoder, c.FetchBatchSize, c.FetchBatchTimeout, c.AdminAddr)
 }
 
 //Validates this ConsumerConfig. Returns a corresponding error if the ConsumerConfig is invalid and nil otherwise.
@@ -259,6 +389,10 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("RebalanceMaxRetries cannot be less than 0")
 	}
 
+	if c.RebalanceProtocol != IncrementalRebalance && c.RebalanceProtocol != EagerRebalance {
+		return errors.New(fmt.Sprintf("RebalanceProtocol must be either \"%s\" or \"%s\"", IncrementalRebalance, EagerRebalance))
+	}
+
 	if c.OffsetsCommitMaxRetries < 0 {
 		return errors.New("OffsetsCommitMaxRetries cannot be less than 0")
 	}
@@ -267,6 +401,18 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New(fmt.Sprintf("OffsetsStorage must be either \"%s\" or \"%s\"", ZookeeperOffsetStorage, KafkaOffsetStorage))
 	}
 
+	if c.OffsetsCommitBackoff < 0 {
+		return errors.New("OffsetsCommitBackoff cannot be negative")
+	}
+
+	if c.CommitFailurePolicy != ContinueOnCommitFailure && c.CommitFailurePolicy != PauseOnCommitFailure && c.CommitFailurePolicy != CloseOnCommitFailure {
+		return errors.New(fmt.Sprintf("CommitFailurePolicy must be either \"%s\", \"%s\" or \"%s\"", ContinueOnCommitFailure, PauseOnCommitFailure, CloseOnCommitFailure))
+	}
+
+	if c.OffsetCommitMode != IntervalCommit && c.OffsetCommitMode != BatchCommit && c.OffsetCommitMode != ManualCommit {
+		return errors.New(fmt.Sprintf("OffsetCommitMode must be either \"%s\", \"%s\" or \"%s\"", IntervalCommit, BatchCommit, ManualCommit))
+	}
+
 	if c.AutoOffsetReset != SmallestOffset && c.AutoOffsetReset != LargestOffset {
 		return errors.New(fmt.Sprintf("AutoOffsetReset must be either \"%s\" or \"%s\"", SmallestOffset, LargestOffset))
 	}
@@ -275,8 +421,12 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Clientid cannot be empty")
 	}
 
-	if c.PartitionAssignmentStrategy != RangeStrategy && c.PartitionAssignmentStrategy != RoundRobinStrategy {
-		return errors.New(fmt.Sprintf("PartitionAssignmentStrategy must be either \"%s\" or \"%s\"", RangeStrategy, RoundRobinStrategy))
+	if !isPartitionAssignorRegistered(c.PartitionAssignmentStrategy) {
+		return errors.New(fmt.Sprintf("PartitionAssignmentStrategy must be either \"%s\", \"%s\", \"%s\", \"%s\" or a strategy registered with RegisterPartitionAssignor", RangeStrategy, RoundRobinStrategy, StickyStrategy, WeightedStrategy))
+	}
+
+	if c.AssignmentWeight <= 0 {
+		return errors.New("AssignmentWeight should be at least 1")
 	}
 
 	if c.NumWorkers <= 0 {
@@ -295,8 +445,22 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Please provide a WorkerFailedAttemptCallback")
 	}
 
-	if c.Strategy == nil {
-		return errors.New("Please provide a Strategy")
+	for _, delay := range c.RetryTopicDelays {
+		if delay <= 0 {
+			return errors.New("RetryTopicDelays should be positive")
+		}
+	}
+
+	if c.PullMode && c.BatchStrategy != nil {
+		return errors.New("BatchStrategy cannot be used with PullMode")
+	}
+
+	if c.Strategy == nil && c.BatchStrategy == nil && !c.PullMode {
+		return errors.New("Please provide a Strategy or a BatchStrategy")
+	}
+
+	if c.Strategy != nil && c.BatchStrategy != nil {
+		return errors.New("Only one of Strategy and BatchStrategy should be provided")
 	}
 
 	if c.FetchBatchSize <= 0 {
@@ -315,8 +479,16 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Please provide a Coordinator")
 	}
 
-	if c.BlueGreenDeploymentEnabled && c.PartitionAssignmentStrategy != RangeStrategy {
-		return errors.New("In order to use Blue-Green deployment Range partition assignment strategy should be used")
+	if c.OffsetStore == nil && c.OffsetsStorage == ZookeeperOffsetStorage {
+		if _, ok := c.Coordinator.(*ZookeeperCoordinator); !ok {
+			return errors.New("Please provide an OffsetStore as Zookeeper offset storage requires ZookeeperCoordinator")
+		}
+	}
+
+	//consumers of a group subscribe to different topics while a blue-green deployment moves them to new topics.
+	//Range and sticky strategies assign each topic on its own among its subscribers, so they keep working.
+	if c.BlueGreenDeploymentEnabled && c.PartitionAssignmentStrategy != RangeStrategy && c.PartitionAssignmentStrategy != StickyStrategy {
+		return errors.New("In order to use Blue-Green deployment Range or Sticky partition assignment strategy should be used")
 	}
 
 	return nil
@@ -339,14 +511,25 @@ func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
 	if setInt32Entry(&config.FetchMinBytes, c["fetch.min.bytes"]) != nil { return nil, err }
 	if setInt32Entry(&config.FetchWaitMaxMs, c["fetch.wait.max.ms"]) != nil { return nil, err }
 	if setDurationEntry(&config.RebalanceBackoff, c["rebalance.backoff"]) != nil { return nil, err }
+	setStringEntry(&config.RebalanceProtocol, c["rebalance.protocol"])
 	if setDurationEntry(&config.RefreshLeaderBackoff, c["refresh.leader.backoff"]) != nil { return nil, err }
 	if setIntEntry(&config.OffsetsCommitMaxRetries, c["offset.commit.max.retries"]) != nil { return nil, err }
 	if setDurationEntry(&config.OffsetCommitInterval, c["offset.commit.interval"]) != nil { return nil, err }
+	setStringEntry(&config.OffsetCommitMode, c["offset.commit.mode"])
+	if err := setDurationEntry(&config.OffsetsCommitBackoff, c["offset.commit.backoff"]); err != nil { return nil, err }
+	setStringEntry(&config.CommitFailurePolicy, c["commit.failure.policy"])
 	setStringEntry(&config.OffsetsStorage, c["offsets.storage"])
 	setStringEntry(&config.AutoOffsetReset, c["auto.offset.reset"])
+	if err := setTimeEntry(&config.StartFromTime, c["start.from.time"]); err != nil { return nil, err }
 	setBoolEntry(&config.ExcludeInternalTopics, c["exclude.internal.topics"])
 	setStringEntry(&config.PartitionAssignmentStrategy, c["partition.assignment.strategy"])
+	if err := setIntEntry(&config.AssignmentWeight, c["assignment.weight"]); err != nil { return nil, err }
+	if err := setStringMapEntry(&config.AssignmentTags, c["assignment.tags"]); err != nil { return nil, err }
+	setStringEntry(&config.DeadLetterTopic, c["dead.letter.topic"])
+	if err := setDurationListEntry(&config.RetryTopicDelays, c["retry.topic.delays"]); err != nil { return nil, err }
 	if setIntEntry(&config.NumWorkers, c["num.workers"]) != nil { return nil, err }
+	setBoolEntry(&config.KeyOrderedProcessing, c["key.ordered.processing"])
+	setBoolEntry(&config.PullMode, c["pull.mode"])
 	if setIntEntry(&config.MaxWorkerRetries, c["max.worker.retries"]) != nil { return nil, err }
 	if setInt32Entry(&config.WorkerRetryThreshold, c["worker.retry.threshold"]) != nil { return nil, err }
 	if setDurationEntry(&config.WorkerThresholdTimeWindow, c["worker.threshold.time.window"]) != nil { return nil, err }
@@ -361,6 +544,7 @@ func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
 	if setDurationEntry(&config.FetchTopicMetadataBackoff, c["fetch.topic.metadata.backoff"]) != nil { return nil, err }
 	if setDurationEntry(&config.FetchRequestBackoff, c["fetch.request.backoff"]) != nil { return nil, err }
 	setBoolEntry(&config.BlueGreenDeploymentEnabled, c["blue.green.deployment.enabled"])
+	setStringEntry(&config.AdminAddr, c["admin.addr"])
 
 	return config, nil
 }
@@ -388,6 +572,53 @@ func setDurationEntry(where *time.Duration, what string) error {
 	return nil
 }
 
+// Accepts either an RFC3339 timestamp or a duration that is subtracted from the current time, e.g. 2h to start from messages produced 2 hours ago.
+func setTimeEntry(where *time.Time, what string) error {
+	if what != "" {
+		if duration, err := time.ParseDuration(what); err == nil {
+			*where = time.Now().Add(-duration)
+			return nil
+		}
+		value, err := time.Parse(time.RFC3339, what)
+		if err == nil {
+			*where = value
+		}
+		return err
+	}
+	return nil
+}
+
+func setDurationListEntry(where *[]time.Duration, what string) error {
+	if what != "" {
+		values := make([]time.Duration, 0)
+		for _, entry := range strings.Split(what, ",") {
+			value, err := time.ParseDuration(strings.TrimSpace(entry))
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		*where = values
+	}
+	return nil
+}
+
+// Accepts comma-separated key=value pairs, e.g. zone=a,host=large-1.
+func setStringMapEntry(where *map[string]string, what string) error {
+	if what != "" {
+		values := make(map[string]string)
+		for _, entry := range strings.Split(what, ",") {
+			keyValue := strings.SplitN(entry, "=", 2)
+			if len(keyValue) != 2 {
+				return fmt.Errorf("Invalid key=value entry: %s", entry)
+			}
+			values[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+		*where = values
+	}
+	return nil
+}
+
 func setIntEntry(where *int, what string) error {
 	if what != "" {
 		value, err := strconv.Atoi(what)
@@ -17,6 +17,7 @@ package go_kafka_client
 
 import (
 	"fmt"
+	metrics "github.com/rcrowley/go-metrics"
 	"sync"
 	"testing"
 	"time"
@@ -213,3 +214,167 @@ func newCountingStrategy(t *testing.T, expectedMessages int, timeout time.Durati
 		return NewSuccessfulResult(id)
 	}
 }
+
+func TestRebalanceCallbacks(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.MetricsRegistry = metrics.NewRegistry()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	processing := make(chan int64, 10)
+	release := make(chan bool)
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		processing <- msg.Offset
+		<-release
+		return NewSuccessfulResult(id)
+	}
+	revoked := make(chan []TopicAndPartition, 1)
+	config.OnPartitionsRevoked = func(topicPartitions []TopicAndPartition) {
+		revoked <- topicPartitions
+	}
+	var assigned []TopicAndPartition
+	config.OnPartitionsAssigned = func(topicPartitions []TopicAndPartition) {
+		assigned = topicPartitions
+	}
+
+	tp0 := TopicAndPartition{"fakeTopic", 0}
+	tp1 := TopicAndPartition{"fakeTopic", 1}
+	consumer := &Consumer{
+		config:                 config,
+		workerManagers:         make(map[TopicAndPartition]*WorkerManager),
+		numWorkerManagersGauge: metrics.NewGauge(),
+		metricNames:            make(map[string]bool),
+		topicRegistry: map[string]map[int32]*partitionTopicInfo{
+			"fakeTopic": map[int32]*partitionTopicInfo{0: &partitionTopicInfo{}, 1: &partitionTopicInfo{}},
+		},
+	}
+	for _, tp := range []TopicAndPartition{tp0, tp1} {
+		consumer.workerManagers[tp] = NewWorkerManager(fmt.Sprintf("test-WM-rebalance-%d", tp.Partition), config, tp,
+			metrics.NewTimer(), metrics.NewTimer(), metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+		go consumer.workerManagers[tp].Start()
+	}
+	consumer.workerManagers[tp0].inputChannel <- []*Message{&Message{Topic: tp0.Topic, Partition: tp0.Partition, Offset: 0}}
+	<-processing
+
+	//partitions are revoked only after in-flight tasks are done and committed
+	go consumer.revokePartitions(consumer.ownedTopicPartitions())
+	select {
+	case <-revoked:
+		t.Error("Partitions revoked before in-flight tasks are finished")
+	case <-time.After(500 * time.Millisecond):
+	}
+	release <- true
+	assert(t, <-revoked, []TopicAndPartition{tp0, tp1})
+	offset, _ := offsetStore.GetOffset(config.Groupid, &tp0)
+	assert(t, offset, int64(0))
+
+	//retained partitions are processed again once assigned, lost ones are dropped
+	delete(consumer.topicRegistry["fakeTopic"], 1)
+	consumer.initializeWorkerManagers()
+	consumer.partitionsAssigned()
+	assert(t, assigned, []TopicAndPartition{tp0})
+	assert(t, len(consumer.workerManagers), 1)
+	consumer.workerManagers[tp0].inputChannel <- []*Message{&Message{Topic: tp0.Topic, Partition: tp0.Partition, Offset: 1}}
+	assert(t, <-processing, int64(1))
+	release <- true
+	<-consumer.workerManagers[tp0].Stop()
+	offset, _ = offsetStore.GetOffset(config.Groupid, &tp0)
+	assert(t, offset, int64(1))
+}
+
+func TestConsumerClientOwnership(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+	config.Coordinator = newMockZookeeperCoordinator()
+	config.OffsetsStorage = KafkaOffsetStorage
+
+	//a store created by the consumer is kept by the consumer and closed along with it
+	consumer := NewConsumer(config)
+	assert(t, config.OffsetStore, nil)
+	_, isKafkaStore := consumer.config.OffsetStore.(*KafkaOffsetStore)
+	assert(t, isKafkaStore, true)
+	assert(t, consumer.createdOffsetStore == consumer.config.OffsetStore, true)
+	other := NewConsumer(config)
+	assert(t, other.config.OffsetStore == consumer.config.OffsetStore, false)
+
+	//so is a metrics registry it creates, and consumers created from the same config do not share metrics
+	assert(t, config.MetricsRegistry, nil)
+	assertNot(t, consumer.config.MetricsRegistry, nil)
+	assert(t, other.config.MetricsRegistry == consumer.config.MetricsRegistry, false)
+
+	//a store set in the config belongs to the caller and stays open
+	store := newMockOffsetStore()
+	config.OffsetStore = store
+	consumer = NewConsumer(config)
+	assert(t, consumer.createdOffsetStore, nil)
+	consumer.closeCreatedClients()
+	assert(t, store.closed, false)
+
+	//so does a dead letter producer
+	deadLetterProducer := newMockProducer()
+	config.DeadLetterTopic = "dead-letters"
+	config.DeadLetterProducer = deadLetterProducer
+	consumer = NewConsumer(config)
+	assert(t, consumer.createdProducer == nil, true)
+	consumer.closeCreatedClients()
+	assert(t, deadLetterProducer.closed, false)
+
+	//and a retry producer
+	retryProducer := newMockProducer()
+	config.RetryTopicDelays = []time.Duration{time.Minute}
+	config.RetryProducer = retryProducer
+	consumer = NewConsumer(config)
+	assert(t, consumer.createdProducer == nil, true)
+	consumer.closeCreatedClients()
+	assert(t, retryProducer.closed, false)
+	assert(t, deadLetterProducer.closed, false)
+}
+
+func TestOwnershipChanges(t *testing.T) {
+	assignor := newPartitionAssignor(RangeStrategy)
+	topicRegistryOf := func(partitionOwnershipDecision map[TopicAndPartition]ConsumerThreadId) map[string]map[int32]*partitionTopicInfo {
+		topicRegistry := make(map[string]map[int32]*partitionTopicInfo)
+		for topicPartition := range partitionOwnershipDecision {
+			if _, exists := topicRegistry[topicPartition.Topic]; !exists {
+				topicRegistry[topicPartition.Topic] = make(map[int32]*partitionTopicInfo)
+			}
+			topicRegistry[topicPartition.Topic][topicPartition.Partition] = &partitionTopicInfo{Topic: topicPartition.Topic, Partition: topicPartition.Partition}
+		}
+		return topicRegistry
+	}
+	contextFor := func(consumer string, consumersInGroup []string, threadIds []ConsumerThreadId) *AssignmentContext {
+		return &AssignmentContext{
+			ConsumerId:         consumer,
+			Group:              "group",
+			PartitionsForTopic: partitionsForTopic,
+			ConsumersForTopic:  map[string][]ConsumerThreadId{"topic1": threadIds},
+			Consumers:          consumersInGroup,
+			MyTopicThreadIds: map[string][]ConsumerThreadId{
+				"topic1": []ConsumerThreadId{ConsumerThreadId{consumer, 0}, ConsumerThreadId{consumer, 1}},
+			},
+		}
+	}
+
+	//a single consumer gets all partitions
+	decision := assignor(contextFor("consumerid1", consumers[:1], consumerThreadIds[:2]))
+	revoked, claimed := ownershipChanges(make(map[string]map[int32]*partitionTopicInfo), decision)
+	assert(t, len(revoked), 0)
+	assert(t, len(claimed), totalPartitions)
+	topicRegistry := topicRegistryOf(decision)
+
+	//once the second consumer joins, the first one gives up only partitions that move and claims nothing
+	decision = assignor(contextFor("consumerid1", consumers, consumerThreadIds))
+	revoked, claimed = ownershipChanges(topicRegistry, decision)
+	assert(t, revoked, []TopicAndPartition{TopicAndPartition{"topic1", 3}, TopicAndPartition{"topic1", 4}})
+	assert(t, len(claimed), 0)
+
+	//while the second one claims exactly these partitions
+	decision = assignor(contextFor("consumerid2", consumers, consumerThreadIds))
+	revoked, claimed = ownershipChanges(make(map[string]map[int32]*partitionTopicInfo), decision)
+	assert(t, len(revoked), 0)
+	assert(t, claimed, map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 3}: ConsumerThreadId{"consumerid2", 0},
+		TopicAndPartition{"topic1", 4}: ConsumerThreadId{"consumerid2", 1},
+	})
+}
@@ -23,12 +23,13 @@ import (
 	"os"
 	"os/signal"
 	"net"
+	"net/http"
 	"strconv"
 	kafkaClient "github.com/stealthly/go_kafka_client"
 	metrics "github.com/rcrowley/go-metrics"
 )
 
-func resolveConfig() (*kafkaClient.ConsumerConfig, string, int, string, time.Duration) {
+func resolveConfig() (*kafkaClient.ConsumerConfig, string, int, string, time.Duration, string) {
 	rawConfig, err := kafkaClient.LoadConfiguration("consumers.properties")
 	if err != nil {
 		panic("Failed to load configuration file")
@@ -65,6 +66,7 @@ func resolveConfig() (*kafkaClient.ConsumerConfig, string, int, string, time.Dur
 	time.ParseDuration(rawConfig["fetch_metadata_backoff"])
 
 	offsetsCommitMaxRetries, _ := strconv.Atoi(rawConfig["offsets_commit_max_retries"])
+	startFrom, _ := time.ParseDuration(rawConfig["start_from"])
 
 	flushInterval, _ := time.ParseDuration(rawConfig["flush_interval"])
 	deploymentTimeout, _ := time.ParseDuration(rawConfig["deployment_timeout"])
@@ -101,17 +103,24 @@ func resolveConfig() (*kafkaClient.ConsumerConfig, string, int, string, time.Dur
 	config.Coordinator = kafkaClient.NewZookeeperCoordinator(zkConfig)
 	config.OffsetsStorage = rawConfig["offsets_storage"]
 	config.AutoOffsetReset = rawConfig["auto_offset_reset"]
+	if startFrom > 0 {
+		config.StartFromTime = time.Now().Add(-startFrom)
+	}
 	config.OffsetsCommitMaxRetries = offsetsCommitMaxRetries
 	config.DeploymentTimeout = deploymentTimeout
+	config.MetricsRegistry = metrics.DefaultRegistry
 	
-	return config, rawConfig["topic"], numConsumers, rawConfig["graphite_connect"], flushInterval
+	return config, rawConfig["topic"], numConsumers, rawConfig["graphite_connect"], flushInterval, rawConfig["prometheus_addr"]
 }
 
 func main() {
-	config, topic, numConsumers, graphiteConnect, graphiteFlushInterval := resolveConfig()
+	config, topic, numConsumers, graphiteConnect, graphiteFlushInterval, prometheusAddr := resolveConfig()
 	if graphiteConnect != "" {
 		startMetrics(graphiteConnect, graphiteFlushInterval)
 	}
+	if prometheusAddr != "" {
+		startPrometheus(prometheusAddr)
+	}
 
 	ctrlc := make(chan os.Signal, 1)
 	signal.Notify(ctrlc, os.Interrupt)
@@ -145,6 +154,15 @@ func startMetrics(graphiteConnect string, graphiteFlushInterval time.Duration) {
 	})
 }
 
+func startPrometheus(prometheusAddr string) {
+	http.Handle("/metrics", kafkaClient.NewPrometheusExporter(metrics.DefaultRegistry, "kafka"))
+	go func() {
+		if err := http.ListenAndServe(prometheusAddr, nil); err != nil {
+			panic(err)
+		}
+	}()
+}
+
 func startNewConsumer(config kafkaClient.ConsumerConfig, topic string) *kafkaClient.Consumer {
 	config.Strategy = GetStrategy(config.Consumerid)
 	config.WorkerFailureCallback = FailedCallback
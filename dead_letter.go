@@ -0,0 +1,86 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeadLetter is an envelope for a message that failed to be processed and was sent to ConsumerConfig.DeadLetterTopic.
+// It is encoded as JSON.
+type DeadLetter struct {
+	// Topic the failed message came from.
+	Topic string
+
+	// Partition the failed message came from.
+	Partition int32
+
+	// Offset of the failed message.
+	Offset int64
+
+	// Partition key of the failed message.
+	Key []byte
+
+	// Value of the failed message.
+	Value []byte
+
+	// Why processing of the message failed.
+	Reason string
+
+	// Number of retries used to process the message.
+	Retries int
+
+	// Time the message was sent to dead letter topic.
+	Timestamp time.Time
+}
+
+// Creates a new DeadLetter for a given failed Task and the last WorkerResult for it.
+// If WorkerResult implements error interface, its error message is used as failure reason.
+func NewDeadLetter(task *Task, result WorkerResult) *DeadLetter {
+	return &DeadLetter{
+		Topic:     task.Msg.Topic,
+		Partition: task.Msg.Partition,
+		Offset:    task.Msg.Offset,
+		Key:       task.Msg.Key,
+		Value:     task.Msg.Value,
+		Reason:    failureReason(result),
+		Retries:   task.Retries,
+		Timestamp: time.Now(),
+	}
+}
+
+func (dl *DeadLetter) String() string {
+	return fmt.Sprintf("{Topic: %s, Partition: %d, Offset: %d, Reason: %s, Retries: %d}", dl.Topic, dl.Partition, dl.Offset, dl.Reason, dl.Retries)
+}
+
+func failureReason(result WorkerResult) string {
+	switch r := result.(type) {
+	case error:
+		return r.Error()
+	case *TimedOutResult:
+		return "Timed out"
+	case *ProcessingFailedResult:
+		return "Processing failed"
+	default:
+		return fmt.Sprintf("%v", result)
+	}
+}
+
+// FailedAttemptCallback that sends every message that failed to be processed after MaxWorkerRetries to ConsumerConfig.DeadLetterTopic.
+func DeadLetterFailedAttemptCallback(_ *Task, _ WorkerResult) FailedDecision {
+	return SendToDeadLetterTopicAndContinue
+}
@@ -0,0 +1,151 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Decoder is an interface that is used to turn raw message keys and values into typed values.
+// Decoders are called concurrently from different workers, so implementations should be thread-safe.
+type Decoder interface {
+	/* Decodes given bytes into a typed value. Returns an error if the bytes cannot be decoded. */
+	Decode(bytes []byte) (interface{}, error)
+}
+
+// JsonDecoder is a Decoder that decodes JSON encoded messages.
+type JsonDecoder struct {
+	newValue func() interface{}
+}
+
+// Creates a new JsonDecoder. If newValue is not nil it should return a pointer to a new value to decode JSON into, e.g. func() interface{} { return &Event{} }.
+// Otherwise JSON is decoded into generic values (map[string]interface{}, []interface{}, float64, string, bool or nil).
+func NewJsonDecoder(newValue func() interface{}) *JsonDecoder {
+	return &JsonDecoder{newValue}
+}
+
+// Decodes given JSON bytes.
+func (d *JsonDecoder) Decode(bytes []byte) (interface{}, error) {
+	if d.newValue == nil {
+		var value interface{}
+		err := json.Unmarshal(bytes, &value)
+		return value, err
+	}
+
+	value := d.newValue()
+	if err := json.Unmarshal(bytes, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// ProtobufMessage is a protocol buffers message that can unmarshal itself from its wire format.
+// Messages generated by gogoprotobuf and any message implementing proto.Unmarshaler satisfy this interface.
+type ProtobufMessage interface {
+	Unmarshal(bytes []byte) error
+}
+
+// ProtobufDecoder is a Decoder that decodes messages encoded in protocol buffers wire format.
+type ProtobufDecoder struct {
+	newMessage func() ProtobufMessage
+}
+
+// Creates a new ProtobufDecoder that unmarshals bytes into messages created by newMessage.
+func NewProtobufDecoder(newMessage func() ProtobufMessage) *ProtobufDecoder {
+	return &ProtobufDecoder{newMessage}
+}
+
+// Decodes given protocol buffers bytes into a new message.
+func (d *ProtobufDecoder) Decode(bytes []byte) (interface{}, error) {
+	message := d.newMessage()
+	if err := message.Unmarshal(bytes); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// AvroDecoder is a Decoder that decodes messages encoded in Avro binary format with a given writer schema.
+type AvroDecoder struct {
+	schema *AvroSchema
+}
+
+// Creates a new AvroDecoder for a given Avro schema in JSON format. Returns an error if the schema cannot be parsed.
+// Records are decoded into map[string]interface{}, see AvroSchema.Decode for other types.
+func NewAvroDecoder(schema string) (*AvroDecoder, error) {
+	avroSchema, err := ParseAvroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroDecoder{avroSchema}, nil
+}
+
+// Decodes given Avro binary bytes.
+func (d *AvroDecoder) Decode(bytes []byte) (interface{}, error) {
+	return d.schema.Decode(bytes)
+}
+
+// An implementation of WorkerResult interface representing a failure to decode a message key or value with ConsumerConfig.KeyDecoder or ConsumerConfig.ValueDecoder.
+// Such tasks are not retried as decoding would fail again, and WorkerFailedAttemptCallback is called right away.
+type DecodingFailedResult struct {
+	id  TaskId
+	err error
+}
+
+// Creates a new DecodingFailedResult for given TaskId and decoding error.
+func NewDecodingFailedResult(id TaskId, err error) *DecodingFailedResult {
+	return &DecodingFailedResult{id, err}
+}
+
+func (dr *DecodingFailedResult) String() string {
+	return fmt.Sprintf("{Decoding failed: %s, %s}", dr.Id(), dr.err)
+}
+
+// Returns an id of task that was processed.
+func (dr *DecodingFailedResult) Id() TaskId {
+	return dr.id
+}
+
+// Always returns false for DecodingFailedResult.
+func (dr *DecodingFailedResult) Success() bool {
+	return false
+}
+
+// Returns the decoding error.
+func (dr *DecodingFailedResult) Error() string {
+	return fmt.Sprintf("Failed to decode message: %s", dr.err)
+}
+
+// Decodes key and value of a given message with configured decoders and stores decoded values in the message.
+func decodeMessage(config *ConsumerConfig, message *Message) error {
+	if config.KeyDecoder != nil && message.Key != nil {
+		key, err := config.KeyDecoder.Decode(message.Key)
+		if err != nil {
+			return fmt.Errorf("key: %s", err)
+		}
+		message.DecodedKey = key
+	}
+
+	if config.ValueDecoder != nil {
+		value, err := config.ValueDecoder.Decode(message.Value)
+		if err != nil {
+			return fmt.Errorf("value: %s", err)
+		}
+		message.DecodedValue = value
+	}
+
+	return nil
+}
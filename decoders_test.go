@@ -0,0 +1,127 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "test",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"},
+		{"name": "nickname", "type": ["null", "string"]},
+		{"name": "color", "type": {"type": "enum", "name": "Color", "symbols": ["RED", "GREEN"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "friend", "type": ["null", "User"]}
+	]
+}`
+
+type testEvent struct {
+	Name  string
+	Count int
+}
+
+type testProtobufMessage struct {
+	data []byte
+}
+
+func (m *testProtobufMessage) Unmarshal(bytes []byte) error {
+	if len(bytes) == 0 {
+		return errors.New("empty message")
+	}
+	m.data = bytes
+	return nil
+}
+
+func TestJsonDecoder(t *testing.T) {
+	value, err := NewJsonDecoder(nil).Decode([]byte(`{"Name": "event", "Count": 3}`))
+	assert(t, err, nil)
+	assert(t, value, map[string]interface{}{"Name": "event", "Count": float64(3)})
+
+	decoder := NewJsonDecoder(func() interface{} { return &testEvent{} })
+	value, err = decoder.Decode([]byte(`{"Name": "event", "Count": 3}`))
+	assert(t, err, nil)
+	assert(t, value, &testEvent{"event", 3})
+
+	_, err = decoder.Decode([]byte("not a json"))
+	assertNot(t, err, nil)
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	decoder := NewProtobufDecoder(func() ProtobufMessage { return &testProtobufMessage{} })
+	value, err := decoder.Decode([]byte{0x08, 0x96, 0x01})
+	assert(t, err, nil)
+	assert(t, value, &testProtobufMessage{[]byte{0x08, 0x96, 0x01}})
+
+	_, err = decoder.Decode([]byte{})
+	assertNot(t, err, nil)
+}
+
+func TestAvroDecoder(t *testing.T) {
+	decoder, err := NewAvroDecoder(testAvroSchema)
+	assert(t, err, nil)
+
+	data := avroLongs(nil, 4)
+	data = append(data, "john"...)
+	data = avroLongs(data, 42, 1, 6)
+	data = append(data, "johnny"...)
+	data = avroLongs(data, 1, 2, 1)
+	data = append(data, "a"...)
+	data = avroLongs(data, 1)
+	data = append(data, "b"...)
+	data = avroLongs(data, 0, 1, 4)
+	data = append(data, "jane"...)
+	data = avroLongs(data, -1, 0, 0, 0, 0)
+
+	value, err := decoder.Decode(data)
+	assert(t, err, nil)
+	assert(t, value, map[string]interface{}{
+		"name":     "john",
+		"age":      int32(42),
+		"nickname": "johnny",
+		"color":    "GREEN",
+		"tags":     []interface{}{"a", "b"},
+		"friend": map[string]interface{}{
+			"name":     "jane",
+			"age":      int32(-1),
+			"nickname": nil,
+			"color":    "RED",
+			"tags":     []interface{}{},
+			"friend":   nil,
+		},
+	})
+
+	_, err = decoder.Decode(data[:len(data)-1])
+	assertNot(t, err, nil)
+
+	_, err = NewAvroDecoder(`{"type": "record", "name": "Broken", "fields": [{"name": "field", "type": "Unknown"}]}`)
+	assertNot(t, err, nil)
+}
+
+func avroLongs(data []byte, values ...int64) []byte {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	for _, value := range values {
+		n := binary.PutVarint(buffer, value)
+		data = append(data, buffer[:n]...)
+	}
+	return data
+}
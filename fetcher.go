@@ -41,6 +41,12 @@ type consumerFetcherManager struct {
 	askNextFetchersLock   sync.RWMutex
 	isReady               bool
 	isReadyLock           sync.RWMutex
+	highWatermarks        map[TopicAndPartition]int64
+	highWatermarksLock    sync.RWMutex
+	paused                bool
+	pausedPartitions      map[TopicAndPartition]bool
+	pausedAsks            map[TopicAndPartition]bool
+	pauseLock             sync.Mutex
 
 	numFetchRoutinesCounter metrics.Counter
 	idleTimer               metrics.Timer
@@ -54,6 +60,22 @@ func (m *consumerFetcherManager) String() string {
 	return fmt.Sprintf("%s-manager", m.config.Consumerid)
 }
 
+// Metrics registered by a fetcher manager.
+var fetcherMetricNames = []string{"NumFetchRoutines", "FetchersIdleTime", "FetchDuration"}
+
+// Returns a name to register a fetcher metric with, labeled with the consumer id and group.
+func (m *consumerFetcherManager) metricName(name string) string {
+	return LabelMetric(formatMetricName(name, m.String(), nil), name, consumerMetricLabels(m.config, nil))
+}
+
+func (m *consumerFetcherManager) unregisterMetrics() {
+	for _, name := range fetcherMetricNames {
+		registeredName := formatMetricName(name, m.String(), nil)
+		m.config.MetricsRegistry.Unregister(registeredName)
+		UnlabelMetric(registeredName)
+	}
+}
+
 func newConsumerFetcherManager(config *ConsumerConfig, askNext chan TopicAndPartition, fetcherBarrier *barrier) *consumerFetcherManager {
 	manager := &consumerFetcherManager{
 		config:             config,
@@ -64,13 +86,16 @@ func newConsumerFetcherManager(config *ConsumerConfig, askNext chan TopicAndPart
 		askNext:            askNext,
 		askNextStopper:     make(chan bool),
 		askNextFetchers:    make(map[TopicAndPartition]chan TopicAndPartition),
+		highWatermarks:     make(map[TopicAndPartition]int64),
+		pausedPartitions:   make(map[TopicAndPartition]bool),
+		pausedAsks:         make(map[TopicAndPartition]bool),
 		switchTopic:        make(chan bool),
 		fetcherBarrier:     fetcherBarrier,
 	}
 	manager.leaderCond = sync.NewCond(&manager.partitionMapLock)
-	manager.numFetchRoutinesCounter = metrics.NewRegisteredCounter(fmt.Sprintf("NumFetchRoutines-%s", manager.String()), metrics.DefaultRegistry)
-	manager.idleTimer = metrics.NewRegisteredTimer(fmt.Sprintf("FetchersIdleTime-%s", manager.String()), metrics.DefaultRegistry)
-	manager.fetchDurationTimer = metrics.NewRegisteredTimer(fmt.Sprintf("FetchDuration-%s", manager.String()), metrics.DefaultRegistry)
+	manager.numFetchRoutinesCounter = metrics.NewRegisteredCounter(manager.metricName("NumFetchRoutines"), config.MetricsRegistry)
+	manager.idleTimer = metrics.NewRegisteredTimer(manager.metricName("FetchersIdleTime"), config.MetricsRegistry)
+	manager.fetchDurationTimer = metrics.NewRegisteredTimer(manager.metricName("FetchDuration"), config.MetricsRegistry)
 
 	go manager.findLeaders()
 	go manager.waitForNextRequests()
@@ -78,6 +103,124 @@ func newConsumerFetcherManager(config *ConsumerConfig, askNext chan TopicAndPart
 	return manager
 }
 
+// Remembers the latest high watermark offset returned by a broker for a given topic and partition.
+func (m *consumerFetcherManager) updateHighWatermark(topicPartition TopicAndPartition, highWatermark int64) {
+	inWriteLock(&m.highWatermarksLock, func() {
+		m.highWatermarks[topicPartition] = highWatermark
+	})
+}
+
+// Returns the latest known high watermark offset for a given topic and partition or InvalidOffset if nothing was fetched for it yet.
+func (m *consumerFetcherManager) highWatermark(topicPartition TopicAndPartition) int64 {
+	highWatermark := InvalidOffset
+	inReadLock(&m.highWatermarksLock, func() {
+		if offset, exists := m.highWatermarks[topicPartition]; exists {
+			highWatermark = offset
+		}
+	})
+	return highWatermark
+}
+
+// Stops sending fetch requests for given partitions or for all partitions if none are given.
+// Fetch requests asked while paused are remembered and sent once resumed.
+func (m *consumerFetcherManager) pause(topicPartitions ...TopicAndPartition) {
+	inLock(&m.pauseLock, func() {
+		if len(topicPartitions) == 0 {
+			m.paused = true
+		}
+		for _, topicPartition := range topicPartitions {
+			m.pausedPartitions[topicPartition] = true
+		}
+	})
+}
+
+// Resumes sending fetch requests for given partitions or for all partitions if none are given, including the ones paused separately.
+// Asks next for all resumed partitions that were asked while paused.
+func (m *consumerFetcherManager) resume(topicPartitions ...TopicAndPartition) {
+	asks := make([]TopicAndPartition, 0)
+	inLock(&m.pauseLock, func() {
+		if len(topicPartitions) == 0 {
+			m.paused = false
+			m.pausedPartitions = make(map[TopicAndPartition]bool)
+		}
+		for _, topicPartition := range topicPartitions {
+			delete(m.pausedPartitions, topicPartition)
+		}
+		for topicPartition := range m.pausedAsks {
+			if !m.isPartitionPaused(topicPartition) {
+				asks = append(asks, topicPartition)
+				delete(m.pausedAsks, topicPartition)
+			}
+		}
+	})
+
+	go func() {
+		for _, topicPartition := range asks {
+			m.askNext <- topicPartition
+		}
+	}()
+}
+
+// Returns true if fetching is paused for all partitions.
+func (m *consumerFetcherManager) isPaused() bool {
+	paused := false
+	inLock(&m.pauseLock, func() {
+		paused = m.paused
+	})
+	return paused
+}
+
+// Returns partitions paused separately.
+func (m *consumerFetcherManager) pausedTopicPartitions() []TopicAndPartition {
+	topicPartitions := make([]TopicAndPartition, 0)
+	inLock(&m.pauseLock, func() {
+		for topicPartition := range m.pausedPartitions {
+			topicPartitions = append(topicPartitions, topicPartition)
+		}
+	})
+	return topicPartitions
+}
+
+// Should be called under pauseLock.
+func (m *consumerFetcherManager) isPartitionPaused(topicPartition TopicAndPartition) bool {
+	return m.paused || m.pausedPartitions[topicPartition]
+}
+
+// Returns true and remembers the ask if fetching is paused for a given partition so that it can be asked again once resumed.
+func (m *consumerFetcherManager) deferIfPaused(topicPartition TopicAndPartition) bool {
+	deferred := false
+	inLock(&m.pauseLock, func() {
+		if m.isPartitionPaused(topicPartition) {
+			m.pausedAsks[topicPartition] = true
+			deferred = true
+		}
+	})
+	return deferred
+}
+
+// Repositions a given partition so that it is fetched from a given offset and drops its buffered messages.
+// Messages buffered afterwards belong to a given seek generation. Returns an error if the partition is not fetched by this manager.
+func (m *consumerFetcherManager) seek(topicPartition TopicAndPartition, offset int64, generation int32) error {
+	var info *partitionTopicInfo
+	inLock(&m.partitionMapLock, func() {
+		if m.partitionMap != nil {
+			info = m.partitionMap[topicPartition]
+		}
+	})
+	if info == nil {
+		return fmt.Errorf("Partition %s is not fetched by %s", &topicPartition, m)
+	}
+
+	info.Buffer.seek(offset, generation)
+	info.FetchedOffset = offset - 1
+	inLock(&m.fetcherRoutineMapLock, func() {
+		for _, fetcher := range m.fetcherRoutineMap {
+			fetcher.seek(topicPartition, offset)
+		}
+	})
+	return nil
+}
+
 func (m *consumerFetcherManager) notReady() {
 	inWriteLock(&m.isReadyLock, func() {
 		m.isReady = false
@@ -166,6 +309,10 @@ func (m *consumerFetcherManager) waitForNextRequests() {
 		case topicPartition := <-m.askNext:
 			{
 				Tracef(m, "WaitForNextRequests: got asknext for partition=%d", topicPartition.Partition)
+				if m.deferIfPaused(topicPartition) {
+					Debugf(m, "Fetching is paused, deferring asknext for %s", topicPartition)
+					continue
+				}
 				inReadLock(&m.isReadyLock, func() {
 					if m.isReady {
 						Tracef(m, "Manager ready, asking next for %s", topicPartition)
@@ -401,6 +548,7 @@ func (m *consumerFetcherManager) close() <-chan bool {
 		m.askNextStopper <- true
 		m.leaderCond.Broadcast()
 		m.closeAllFetchers()
+		m.unregisterMetrics()
 		m.partitionMap = nil
 		m.noLeaderPartitions = nil
 		m.closeFinished <- true
@@ -454,6 +602,10 @@ func (f *consumerFetcherRoutine) start() {
 			{
 				f.manager.idleTimer.Update(time.Since(ts))
 				Debugf(f, "Received asknext for %s", &nextTopicPartition)
+				if f.manager.deferIfPaused(nextTopicPartition) {
+					Debugf(f, "Fetching is paused, deferring asknext for %s", &nextTopicPartition)
+					continue
+				}
 				config := f.manager.config
 				inReadLock(&f.manager.isReadyLock, func() {
 					if f.manager.isReady {
@@ -524,7 +676,7 @@ func (f *consumerFetcherRoutine) addPartitions(partitionAndOffsets map[TopicAndP
 			if _, contains := f.partitionMap[topicAndPartition]; !contains {
 				validOffset := offset + 1
 				if isOffsetInvalid(offset) {
-					validOffset = f.handleOffsetOutOfRange(&topicAndPartition)
+					validOffset = f.handleNoCommittedOffset(&topicAndPartition)
 				}
 				f.partitionMap[topicAndPartition] = validOffset
 				inWriteLock(&f.manager.askNextFetchersLock, func() {
@@ -565,9 +717,14 @@ func (f *consumerFetcherRoutine) processFetchRequest(request *sarama.FetchReques
 				for partition, data := range partitionAndData {
 					topicAndPartition := TopicAndPartition{topic, partition}
 					if currentOffset, exists := f.partitionMap[topicAndPartition]; exists {
+						if currentOffset != requestedOffset {
+							Infof(f, "Partition %s was seeked to offset %d while fetching from offset %d, ignoring fetched data", &topicAndPartition, currentOffset, requestedOffset)
+							continue
+						}
 						switch data.Err {
 						case sarama.NoError:
 							{
+								f.manager.updateHighWatermark(topicAndPartition, data.HighWaterMarkOffset)
 								messages := data.MsgSet.Messages
 								newOffset := currentOffset
 								if len(messages) > 0 {
@@ -625,7 +782,7 @@ func (f *consumerFetcherRoutine) processPartitionData(topicAndPartition TopicAnd
 
 	partitionTopicInfo := f.allPartitionMap[topicAndPartition] //TODO this is potentially unsafe, maybe use allPartitionMapLock here?
 	if len(partitionData.MsgSet.Messages) > 0 {
-		partitionTopicInfo.Buffer.addBatch(&TopicPartitionData{topicAndPartition, partitionData})
+		partitionTopicInfo.Buffer.addBatch(&TopicPartitionData{topicAndPartition, partitionData, fetchOffset})
 		Info(f, "Sent partition data")
 	} else {
 		Debug(f, "Got empty message. Ignoring...")
@@ -648,9 +805,25 @@ func (f *consumerFetcherRoutine) handleOffsetOutOfRange(topicAndPartition *Topic
 		offsetTime = sarama.EarliestOffset
 	}
 
-	newOffset := f.earliestOrLatestOffset(topicAndPartition, offsetTime)
+	return f.resetOffset(topicAndPartition, offsetTime)
+}
+
+// Picks an offset to start fetching a partition with no committed offset from, using ConsumerConfig.StartFromTime if set and AutoOffsetReset otherwise.
+func (f *consumerFetcherRoutine) handleNoCommittedOffset(topicAndPartition *TopicAndPartition) int64 {
+	startFromTime := f.manager.config.StartFromTime
+	if startFromTime.IsZero() {
+		return f.handleOffsetOutOfRange(topicAndPartition)
+	}
+
+	Infof(f, "No offset committed for %s, starting from messages produced at %s", topicAndPartition, startFromTime)
+	return f.resetOffset(topicAndPartition, offsetTimeOf(startFromTime))
+}
+
+func (f *consumerFetcherRoutine) resetOffset(topicAndPartition *TopicAndPartition, offsetTime sarama.OffsetTime) int64 {
+	newOffset := f.offsetForTime(topicAndPartition, offsetTime)
 	partitionTopicInfo := f.allPartitionMap[*topicAndPartition]
 	partitionTopicInfo.FetchedOffset = newOffset
+	partitionTopicInfo.Buffer.resetSeek(newOffset)
 
 	return newOffset
 }
@@ -660,14 +833,14 @@ func (f *consumerFetcherRoutine) handlePartitionsWithErrors(partitions []TopicAn
 	f.manager.addPartitionsWithError(partitions)
 }
 
-func (f *consumerFetcherRoutine) earliestOrLatestOffset(topicAndPartition *TopicAndPartition, offsetTime sarama.OffsetTime) int64 {
+func (f *consumerFetcherRoutine) offsetForTime(topicAndPartition *TopicAndPartition, offsetTime sarama.OffsetTime) int64 {
 	client, err := sarama.NewClient(f.manager.config.Clientid, []string{f.brokerAddr}, nil)
 	if err != nil {
 		panic(err)
 	}
 	defer client.Close()
 
-	offset, err := client.GetOffset(topicAndPartition.Topic, int32(topicAndPartition.Partition), offsetTime)
+	offset, err := getOffset(client, topicAndPartition, offsetTime)
 	if err != nil {
 		panic(err)
 	}
@@ -675,6 +848,16 @@ func (f *consumerFetcherRoutine) earliestOrLatestOffset(topicAndPartition *Topic
 	return offset
 }
 
+// Sets the offset to fetch a given partition from if this fetcher fetches it.
+func (f *consumerFetcherRoutine) seek(topicPartition TopicAndPartition, offset int64) {
+	inLock(&f.partitionMapLock, func() {
+		if _, exists := f.partitionMap[topicPartition]; exists {
+			Infof(f, "Seeking %s to offset %d", &topicPartition, offset)
+			f.partitionMap[topicPartition] = offset
+		}
+	})
+}
+
 func (f *consumerFetcherRoutine) removeAllPartitions() {
 	partitions := make([]TopicAndPartition, 0)
 	for topicPartition, _ := range f.partitionMap {
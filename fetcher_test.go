@@ -17,6 +17,7 @@ package go_kafka_client
 
 import (
 	"github.com/Shopify/sarama"
+	metrics "github.com/rcrowley/go-metrics"
 	"math/rand"
 	"testing"
 	"time"
@@ -67,3 +68,193 @@ func generateMessages(startOffset int64, numMessages int) []*sarama.MessageBlock
 
 	return messages
 }
+
+func TestPausePartitions(t *testing.T) {
+	askNext := make(chan TopicAndPartition, 10)
+	manager := &consumerFetcherManager{
+		askNext:          askNext,
+		pausedPartitions: make(map[TopicAndPartition]bool),
+		pausedAsks:       make(map[TopicAndPartition]bool),
+	}
+	consumer := &Consumer{fetcher: manager, workerManagers: make(map[TopicAndPartition]*WorkerManager)}
+	paused := TopicAndPartition{"fakeTopic", 1}
+	other := TopicAndPartition{"fakeTopic", 0}
+	consumer.workerManagers[paused] = &WorkerManager{}
+	consumer.workerManagers[other] = &WorkerManager{}
+	consumer.workerManagers[TopicAndPartition{"anotherTopic", 0}] = &WorkerManager{}
+
+	//pausing a partition does not affect others
+	consumer.Pause(paused)
+	assert(t, consumer.IsPaused(), false)
+	assert(t, consumer.Paused(), []TopicAndPartition{paused})
+	assert(t, manager.deferIfPaused(paused), true)
+	assert(t, manager.deferIfPaused(other), false)
+
+	//resuming a partition while the whole consumer is paused takes effect once the consumer is resumed
+	consumer.Pause()
+	assert(t, consumer.IsPaused(), true)
+	assert(t, consumer.Paused(), []TopicAndPartition{TopicAndPartition{"anotherTopic", 0}, other, paused})
+	assert(t, manager.deferIfPaused(other), true)
+	consumer.Resume(paused)
+	assert(t, len(askNext), 0)
+	consumer.Resume()
+	assert(t, consumer.Paused(), []TopicAndPartition{})
+
+	asked := make(map[TopicAndPartition]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case topicPartition := <-askNext:
+			asked[topicPartition] = true
+		case <-time.After(time.Second):
+			t.Fatal("Deferred fetch requests should be asked again once resumed")
+		}
+	}
+	assert(t, asked, map[TopicAndPartition]bool{paused: true, other: true})
+
+	//only deferred requests of resumed partitions are asked again
+	consumer.Pause(paused, other)
+	manager.deferIfPaused(paused)
+	manager.deferIfPaused(other)
+	consumer.Resume(other)
+	select {
+	case topicPartition := <-askNext:
+		assert(t, topicPartition, other)
+	case <-time.After(time.Second):
+		t.Fatal("Deferred fetch request should be asked again once resumed")
+	}
+	assert(t, consumer.Paused(), []TopicAndPartition{paused})
+	assert(t, manager.pausedAsks, map[TopicAndPartition]bool{paused: true})
+}
+
+func TestConsumerSeek(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.FetchBatchSize = 100
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", 0}
+
+	askNextBatch := make(chan TopicAndPartition, 10)
+	buffer := newMessageBuffer(topicPartition, make(chan []*Message, 10), config, askNextBatch, make(chan TopicAndPartition, 1))
+	info := &partitionTopicInfo{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Buffer: buffer, FetchedOffset: 2}
+	routine := &consumerFetcherRoutine{partitionMap: map[TopicAndPartition]int64{topicPartition: 10}}
+	manager := &consumerFetcherManager{
+		config:            config,
+		partitionMap:      map[TopicAndPartition]*partitionTopicInfo{topicPartition: info},
+		fetcherRoutineMap: map[brokerAndFetcherId]*consumerFetcherRoutine{brokerAndFetcherId{&BrokerInfo{}, 0}: routine},
+	}
+	workerManager := NewWorkerManager("test-WM-seek", config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+	workerManager.offsetTracker.add(8)
+	workerManager.UpdateLargestOffset(9)
+	consumer := &Consumer{config: config, fetcher: manager, workerManagers: map[TopicAndPartition]*WorkerManager{topicPartition: workerManager}}
+
+	buffer.addBatch(generateBatchFrom(topicPartition, 7, 3))
+	<-askNextBatch
+	assert(t, len(buffer.Messages), 3)
+
+	assert(t, consumer.Seek(topicPartition, 5), nil)
+	assert(t, routine.partitionMap[topicPartition], int64(5))
+	assert(t, info.FetchedOffset, int64(4))
+	assert(t, len(buffer.Messages), 0)
+	assert(t, workerManager.GetLargestOffset(), int64(4))
+	assert(t, workerManager.GetLastCommittedOffset(), int64(4))
+	assert(t, workerManager.GetPendingTasks(), 0)
+	offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(4))
+
+	//data fetched before the seek is dropped, but next batch is still asked
+	buffer.addBatch(generateBatchFrom(topicPartition, 10, 3))
+	<-askNextBatch
+	assert(t, len(buffer.Messages), 0)
+	buffer.addBatch(generateBatchFrom(topicPartition, 5, 3))
+	<-askNextBatch
+	assert(t, len(buffer.Messages), 3)
+	buffer.addBatch(generateBatchFrom(topicPartition, 8, 2))
+	<-askNextBatch
+	assert(t, len(buffer.Messages), 5)
+
+	//messages that were on their way to the worker manager before the seek are dropped
+	batch := []*Message{&Message{Offset: 11}, buffer.Messages[0], buffer.Messages[1]}
+	assert(t, workerManager.dropSeekedMessages(batch), buffer.Messages[:2])
+
+	//seeking to the very first offset has nothing to commit
+	assert(t, consumer.Seek(topicPartition, 0), nil)
+	assert(t, workerManager.GetLastCommittedOffset(), InvalidOffset)
+	assert(t, workerManager.GetLargestOffset(), InvalidOffset)
+	assert(t, routine.partitionMap[topicPartition], int64(0))
+
+	assertNot(t, consumer.Seek(TopicAndPartition{"fakeTopic", 1}, 5), nil)
+}
+
+func generateBatchFrom(topicPartition TopicAndPartition, fetchOffset int64, size int) *TopicPartitionData {
+	messages := make([]*sarama.MessageBlock, 0)
+	for i := 0; i < size; i++ {
+		messages = append(messages, &sarama.MessageBlock{Offset: fetchOffset + int64(i), Msg: &sarama.Message{}})
+	}
+
+	return &TopicPartitionData{
+		TopicPartition: topicPartition,
+		Data: &sarama.FetchResponseBlock{
+			MsgSet: sarama.MessageSet{
+				Messages: messages,
+			},
+		},
+		FetchOffset: fetchOffset,
+	}
+}
+
+func TestOffsetForTime(t *testing.T) {
+	broker := newMockKafkaBroker(t)
+	defer broker.Close()
+
+	mockZk := newMockZookeeperCoordinator()
+	mockZk.brokers = []*BrokerInfo{broker.BrokerInfo(1)}
+	config := DefaultConsumerConfig()
+	config.Coordinator = mockZk
+	consumer := &Consumer{config: config}
+	topicPartition := TopicAndPartition{"fakeTopic", 2}
+	startFromTime := time.Unix(1420070400, 0)
+
+	broker.Returns(metadataResponse(broker, topicPartition.Topic, 3, sarama.NoError))
+	broker.Returns(offsetResponse(topicPartition, 42))
+	offset, err := consumer.offsetForTime(topicPartition, offsetTimeOf(startFromTime))
+	assert(t, err, nil)
+	assert(t, offset, int64(42))
+	broker.NextRequest(time.Second)
+	assert(t, requestedOffsetTime(broker.NextRequest(time.Second)), int64(1420070400000))
+
+	//no log segment is older than the requested time so consuming starts from the earliest offset
+	broker.Returns(metadataResponse(broker, topicPartition.Topic, 3, sarama.NoError))
+	broker.Returns(offsetResponse(topicPartition))
+	broker.Returns(offsetResponse(topicPartition, 7))
+	offset, err = consumer.offsetForTime(topicPartition, offsetTimeOf(startFromTime))
+	assert(t, err, nil)
+	assert(t, offset, int64(7))
+	broker.NextRequest(time.Second)
+	assert(t, requestedOffsetTime(broker.NextRequest(time.Second)), int64(1420070400000))
+	assert(t, requestedOffsetTime(broker.NextRequest(time.Second)), int64(sarama.EarliestOffset))
+}
+
+func offsetResponse(topicPartition TopicAndPartition, offsets ...int64) []byte {
+	response := new(kafkaEncoder)
+	response.int32(1).string(topicPartition.Topic)
+	response.int32(1).int32(topicPartition.Partition).int16(int16(sarama.NoError)).int32(int32(len(offsets)))
+	for _, offset := range offsets {
+		response.int64(offset)
+	}
+	return response.Bytes()
+}
+
+func requestedOffsetTime(request []byte) int64 {
+	decoder := newKafkaDecoder(request)
+	decoder.int16()  //api key
+	decoder.int16()  //api version
+	decoder.int32()  //correlation id
+	decoder.string() //client id
+	decoder.int32()  //replica id
+	decoder.int32()  //topics
+	decoder.string() //topic
+	decoder.int32()  //partitions
+	decoder.int32()  //partition
+	return decoder.int64()
+}
@@ -0,0 +1,403 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	offsetCommitRequestKey int16 = 8
+	offsetFetchRequestKey  int16 = 9
+
+	//Kafka 0.8.2 brokers keep offsets committed with version 0 of OffsetCommit request in Zookeeper and serve version 0 of OffsetFetch request from there too.
+	//Offsets are kept in Kafka only with version 1 of these requests.
+	offsetRequestVersion int16 = 1
+)
+
+// KafkaOffsetStore implements OffsetStore interface and keeps offsets in Kafka.
+// It fetches and commits offsets with version 1 OffsetFetch and OffsetCommit requests sent to the offset manager broker of a consumer group.
+// Offset managers are discovered with a ConsumerMetadata request to any broker known to ConsumerConfig.Coordinator and are cached until a request to them fails.
+type KafkaOffsetStore struct {
+	config         *ConsumerConfig
+	offsetManagers map[string]*offsetManager
+	lock           sync.Mutex
+}
+
+// Creates a new KafkaOffsetStore using connection settings and Coordinator of a given ConsumerConfig.
+// Connections to offset managers are opened lazily on first request.
+func NewKafkaOffsetStore(config *ConsumerConfig) *KafkaOffsetStore {
+	return &KafkaOffsetStore{
+		config:         config,
+		offsetManagers: make(map[string]*offsetManager),
+	}
+}
+
+func (s *KafkaOffsetStore) String() string {
+	return fmt.Sprintf("%s-kafka-offset-store", s.config.Consumerid)
+}
+
+// Gets the offset for a given TopicPartition and consumer group Group from the group's offset manager.
+// Retries up to ConsumerConfig.OffsetsCommitMaxRetries times if the offset manager is not available.
+// Returns InvalidOffset if there is no committed offset for a given TopicPartition yet.
+func (s *KafkaOffsetStore) GetOffset(Group string, TopicPartition *TopicAndPartition) (int64, error) {
+	var err error
+	for i := 0; i <= s.config.OffsetsCommitMaxRetries; i++ {
+		var offset int64
+		offset, err = s.tryGetOffset(Group, TopicPartition)
+		if err == nil {
+			return offset, nil
+		}
+		Tracef(s, "GetOffset for group %s and topic-partition %s failed after %d-th retry: %s", Group, TopicPartition, i, err)
+		time.Sleep(s.config.RefreshLeaderBackoff)
+	}
+	return InvalidOffset, err
+}
+
+func (s *KafkaOffsetStore) tryGetOffset(group string, topicPartition *TopicAndPartition) (int64, error) {
+	offset := InvalidOffset
+	err := s.withOffsetManager(group, func(manager *offsetManager) error {
+		fetchedOffset, err := manager.fetchOffset(s.config.Clientid, group, topicPartition)
+		switch err {
+		case nil:
+			offset = fetchedOffset
+		case sarama.UnknownTopicOrPartition:
+			offset = InvalidOffset
+		default:
+			return err
+		}
+		return nil
+	})
+
+	return offset, err
+}
+
+// Tells the group's offset manager to commit offset Offset for topic and partition TopicPartition for consumer group Group.
+// Returns error if failed to commit offset.
+func (s *KafkaOffsetStore) CommitOffset(Group string, TopicPartition *TopicAndPartition, Offset int64) error {
+	return s.withOffsetManager(Group, func(manager *offsetManager) error {
+		return manager.commitOffset(s.config.Clientid, Group, TopicPartition, Offset)
+	})
+}
+
+func (s *KafkaOffsetStore) withOffsetManager(group string, request func(*offsetManager) error) error {
+	manager, err := s.offsetManager(group)
+	if err != nil {
+		return err
+	}
+
+	err = request(manager)
+	if err != nil {
+		Infof(s, "Offset request to offset manager %s for group %s failed: %s", manager.addr, group, err)
+		s.invalidateOffsetManager(group, manager)
+	}
+	return err
+}
+
+func (s *KafkaOffsetStore) offsetManager(group string) (*offsetManager, error) {
+	var manager *offsetManager
+	var err error
+	inLock(&s.lock, func() {
+		if cached, exists := s.offsetManagers[group]; exists {
+			manager = cached
+			return
+		}
+
+		manager, err = s.discoverOffsetManager(group)
+		if err == nil {
+			s.offsetManagers[group] = manager
+		}
+	})
+
+	return manager, err
+}
+
+func (s *KafkaOffsetStore) discoverOffsetManager(group string) (*offsetManager, error) {
+	brokers, err := s.config.Coordinator.GetAllBrokers()
+	if err != nil {
+		return nil, err
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("No brokers available to discover offset manager")
+	}
+
+	for _, brokerInfo := range brokers {
+		brokerAddr := fmt.Sprintf("%s:%d", brokerInfo.Host, brokerInfo.Port)
+		broker, connectErr := s.connect(brokerAddr)
+		if connectErr != nil {
+			Warnf(s, "Could not connect to broker %s to discover offset manager: %s", brokerAddr, connectErr)
+			err = connectErr
+			continue
+		}
+
+		response, requestErr := broker.GetConsumerMetadata(s.config.Clientid, &sarama.ConsumerMetadataRequest{ConsumerGroup: group})
+		broker.Close()
+		if requestErr != nil {
+			Warnf(s, "Could not get consumer metadata from broker %s: %s", brokerAddr, requestErr)
+			err = requestErr
+			continue
+		}
+		if response.Err != sarama.NoError {
+			Warnf(s, "Broker %s could not provide offset manager for group %s: %s", brokerAddr, group, response.Err)
+			err = response.Err
+			continue
+		}
+
+		managerAddr := fmt.Sprintf("%s:%d", response.CoordinatorHost, response.CoordinatorPort)
+		Debugf(s, "Offset manager for group %s is %s", group, managerAddr)
+		return dialOffsetManager(managerAddr, s.config.SocketTimeout)
+	}
+
+	return nil, err
+}
+
+func (s *KafkaOffsetStore) connect(addr string) (*sarama.Broker, error) {
+	broker := sarama.NewBroker(addr)
+	if err := broker.Open(newSaramaBrokerConfig(s.config)); err != nil {
+		return nil, err
+	}
+	if connected, err := broker.Connected(); !connected {
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+func (s *KafkaOffsetStore) invalidateOffsetManager(group string, manager *offsetManager) {
+	inLock(&s.lock, func() {
+		if s.offsetManagers[group] == manager {
+			delete(s.offsetManagers, group)
+			manager.close()
+		}
+	})
+}
+
+// Closes connections to all offset managers. KafkaOffsetStore reconnects if it is used after Close.
+func (s *KafkaOffsetStore) Close() error {
+	inLock(&s.lock, func() {
+		for group, manager := range s.offsetManagers {
+			manager.close()
+			delete(s.offsetManagers, group)
+		}
+	})
+	return nil
+}
+
+// offsetManager is a connection to the offset manager broker of a consumer group.
+// sarama.Broker encodes OffsetCommit and OffsetFetch requests with version 0 only, so offsetManager encodes them itself with offsetRequestVersion.
+// Requests are sent one at a time.
+type offsetManager struct {
+	addr          string
+	conn          net.Conn
+	timeout       time.Duration
+	correlationId int32
+	lock          sync.Mutex
+}
+
+func dialOffsetManager(addr string, timeout time.Duration) (*offsetManager, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &offsetManager{
+		addr:    addr,
+		conn:    conn,
+		timeout: timeout,
+	}, nil
+}
+
+// Fetches the offset committed for a given topic and partition by a given group.
+// Returns sarama.KError if the offset manager responded with an error for this partition.
+func (m *offsetManager) fetchOffset(clientId string, group string, topicPartition *TopicAndPartition) (int64, error) {
+	request := new(offsetRequestEncoder)
+	request.string(group)
+	request.int32(1).string(topicPartition.Topic)
+	request.int32(1).int32(topicPartition.Partition)
+
+	response, err := m.send(clientId, offsetFetchRequestKey, request)
+	if err != nil {
+		return InvalidOffset, err
+	}
+
+	for topics := response.int32(); topics > 0 && response.err == nil; topics-- {
+		topic := response.string()
+		for partitions := response.int32(); partitions > 0 && response.err == nil; partitions-- {
+			partition := response.int32()
+			offset := response.int64()
+			response.string() //metadata
+			kafkaErr := sarama.KError(response.int16())
+			if response.err == nil && topic == topicPartition.Topic && partition == topicPartition.Partition {
+				if kafkaErr != sarama.NoError {
+					return InvalidOffset, kafkaErr
+				}
+				return offset, nil
+			}
+		}
+	}
+	if response.err != nil {
+		return InvalidOffset, response.err
+	}
+
+	return InvalidOffset, sarama.IncompleteResponse
+}
+
+// Commits a given offset for a given topic and partition and a given group.
+// Returns sarama.KError if the offset manager responded with an error for this partition.
+func (m *offsetManager) commitOffset(clientId string, group string, topicPartition *TopicAndPartition, offset int64) error {
+	request := new(offsetRequestEncoder)
+	request.string(group)
+	request.int32(-1)  //group generation id, consumers of this client are not managed by a Kafka group coordinator
+	request.string("") //consumer id
+	request.int32(1).string(topicPartition.Topic)
+	request.int32(1).int32(topicPartition.Partition).int64(offset).int64(sarama.ReceiveTime).string("")
+
+	response, err := m.send(clientId, offsetCommitRequestKey, request)
+	if err != nil {
+		return err
+	}
+
+	for topics := response.int32(); topics > 0 && response.err == nil; topics-- {
+		topic := response.string()
+		for partitions := response.int32(); partitions > 0 && response.err == nil; partitions-- {
+			partition := response.int32()
+			kafkaErr := sarama.KError(response.int16())
+			if response.err == nil && topic == topicPartition.Topic && partition == topicPartition.Partition {
+				if kafkaErr != sarama.NoError {
+					return kafkaErr
+				}
+				return nil
+			}
+		}
+	}
+	if response.err != nil {
+		return response.err
+	}
+
+	return sarama.IncompleteResponse
+}
+
+// Sends a request with a given api key and body and returns the body of the response that follows its correlation id.
+func (m *offsetManager) send(clientId string, key int16, body *offsetRequestEncoder) (*offsetResponseDecoder, error) {
+	var response *offsetResponseDecoder
+	var err error
+	inLock(&m.lock, func() {
+		m.correlationId++
+		request := new(offsetRequestEncoder)
+		request.int16(key).int16(offsetRequestVersion).int32(m.correlationId).string(clientId)
+		request.Write(body.Bytes())
+
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(request.Len()))
+		if err = m.conn.SetDeadline(time.Now().Add(m.timeout)); err != nil {
+			return
+		}
+		if _, err = m.conn.Write(append(size, request.Bytes()...)); err != nil {
+			return
+		}
+
+		if _, err = io.ReadFull(m.conn, size); err != nil {
+			return
+		}
+		responseBytes := make([]byte, binary.BigEndian.Uint32(size))
+		if _, err = io.ReadFull(m.conn, responseBytes); err != nil {
+			return
+		}
+
+		response = &offsetResponseDecoder{reader: bytes.NewReader(responseBytes)}
+		if correlationId := response.int32(); response.err == nil && correlationId != m.correlationId {
+			err = fmt.Errorf("Correlation id of a response from %s does not match, expected %d, actual %d", m.addr, m.correlationId, correlationId)
+		}
+	})
+
+	return response, err
+}
+
+func (m *offsetManager) close() {
+	m.conn.Close()
+}
+
+type offsetRequestEncoder struct {
+	bytes.Buffer
+}
+
+func (e *offsetRequestEncoder) int16(value int16) *offsetRequestEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *offsetRequestEncoder) int32(value int32) *offsetRequestEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *offsetRequestEncoder) int64(value int64) *offsetRequestEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *offsetRequestEncoder) string(value string) *offsetRequestEncoder {
+	e.int16(int16(len(value)))
+	e.WriteString(value)
+	return e
+}
+
+// offsetResponseDecoder reads a response and keeps the first error, after which it returns zero values only.
+type offsetResponseDecoder struct {
+	reader *bytes.Reader
+	err    error
+}
+
+func (d *offsetResponseDecoder) read(value interface{}) {
+	if d.err == nil {
+		d.err = binary.Read(d.reader, binary.BigEndian, value)
+	}
+}
+
+func (d *offsetResponseDecoder) int16() (value int16) {
+	d.read(&value)
+	return
+}
+
+func (d *offsetResponseDecoder) int32() (value int32) {
+	d.read(&value)
+	return
+}
+
+func (d *offsetResponseDecoder) int64() (value int64) {
+	d.read(&value)
+	return
+}
+
+func (d *offsetResponseDecoder) string() string {
+	length := d.int16()
+	if d.err != nil || length < 0 {
+		return ""
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(d.reader, value); err != nil {
+		d.err = err
+	}
+	return string(value)
+}
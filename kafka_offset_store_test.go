@@ -0,0 +1,136 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"github.com/Shopify/sarama"
+	"testing"
+	"time"
+)
+
+const (
+	offsetCommitKey     int16 = 8
+	offsetFetchKey      int16 = 9
+	consumerMetadataKey int16 = 10
+)
+
+func TestKafkaOffsetStore(t *testing.T) {
+	broker := newMockKafkaBroker(t)
+	defer broker.Close()
+
+	mockZk := newMockZookeeperCoordinator()
+	mockZk.brokers = []*BrokerInfo{broker.BrokerInfo(1)}
+	config := DefaultConsumerConfig()
+	config.Coordinator = mockZk
+	config.OffsetsCommitMaxRetries = 0
+	store := NewKafkaOffsetStore(config)
+	defer store.Close()
+
+	topicPartition := &TopicAndPartition{"fakeTopic", 3}
+
+	//offset manager is discovered before the first offset fetch
+	broker.Returns(consumerMetadataResponse(broker, sarama.NoError))
+	broker.Returns(offsetFetchResponse(topicPartition, 100, sarama.NoError))
+	offset, err := store.GetOffset(config.Groupid, topicPartition)
+	assert(t, err, nil)
+	assert(t, offset, int64(100))
+	assert(t, requestKey(broker.NextRequest(time.Second)), consumerMetadataKey)
+	fetchRequest := broker.NextRequest(time.Second)
+	assert(t, requestKey(fetchRequest), offsetFetchKey)
+	//version 0 requests are served from Zookeeper by Kafka 0.8.2 brokers
+	assert(t, requestVersion(fetchRequest), int16(1))
+
+	//offset manager is cached and the offset is committed as is
+	broker.Returns(offsetCommitResponse(topicPartition, sarama.NoError))
+	err = store.CommitOffset(config.Groupid, topicPartition, 150)
+	assert(t, err, nil)
+	commitRequest := broker.NextRequest(time.Second)
+	assert(t, requestKey(commitRequest), offsetCommitKey)
+	assert(t, requestVersion(commitRequest), int16(1))
+	assert(t, committedOffset(commitRequest), int64(150))
+
+	//missing offset is reported as InvalidOffset
+	broker.Returns(offsetFetchResponse(topicPartition, -1, sarama.UnknownTopicOrPartition))
+	offset, err = store.GetOffset(config.Groupid, topicPartition)
+	assert(t, err, nil)
+	assert(t, offset, InvalidOffset)
+	broker.NextRequest(time.Second)
+
+	//offset manager is rediscovered after it has moved
+	broker.Returns(offsetCommitResponse(topicPartition, sarama.NotCoordinatorForConsumer))
+	err = store.CommitOffset(config.Groupid, topicPartition, 160)
+	assert(t, err, sarama.NotCoordinatorForConsumer)
+	broker.NextRequest(time.Second)
+
+	broker.Returns(consumerMetadataResponse(broker, sarama.NoError))
+	broker.Returns(offsetCommitResponse(topicPartition, sarama.NoError))
+	err = store.CommitOffset(config.Groupid, topicPartition, 160)
+	assert(t, err, nil)
+	assert(t, requestKey(broker.NextRequest(time.Second)), consumerMetadataKey)
+	assert(t, committedOffset(broker.NextRequest(time.Second)), int64(160))
+
+	//offset fetch fails if no broker knows the offset manager
+	store.Close()
+	broker.Returns(consumerMetadataResponse(broker, sarama.ConsumerCoordinatorNotAvailable))
+	_, err = store.GetOffset(config.Groupid, topicPartition)
+	assert(t, err, sarama.ConsumerCoordinatorNotAvailable)
+}
+
+func consumerMetadataResponse(broker *mockKafkaBroker, kafkaErr sarama.KError) []byte {
+	response := new(kafkaEncoder)
+	response.int16(int16(kafkaErr)).int32(1).string(broker.host).int32(broker.port)
+	return response.Bytes()
+}
+
+func offsetFetchResponse(topicPartition *TopicAndPartition, offset int64, kafkaErr sarama.KError) []byte {
+	response := new(kafkaEncoder)
+	response.int32(1).string(topicPartition.Topic)
+	response.int32(1).int32(topicPartition.Partition).int64(offset).string("").int16(int16(kafkaErr))
+	return response.Bytes()
+}
+
+func offsetCommitResponse(topicPartition *TopicAndPartition, kafkaErr sarama.KError) []byte {
+	response := new(kafkaEncoder)
+	response.int32(1).string(topicPartition.Topic)
+	response.int32(1).int32(topicPartition.Partition).int16(int16(kafkaErr))
+	return response.Bytes()
+}
+
+func requestKey(request []byte) int16 {
+	return newKafkaDecoder(request).int16()
+}
+
+func requestVersion(request []byte) int16 {
+	decoder := newKafkaDecoder(request)
+	decoder.int16() //api key
+	return decoder.int16()
+}
+
+func committedOffset(request []byte) int64 {
+	decoder := newKafkaDecoder(request)
+	decoder.int16()  //api key
+	decoder.int16()  //api version
+	decoder.int32()  //correlation id
+	decoder.string() //client id
+	decoder.string() //consumer group
+	decoder.int32()  //group generation id
+	decoder.string() //consumer id
+	decoder.int32()  //topics
+	decoder.string() //topic
+	decoder.int32()  //partitions
+	decoder.int32()  //partition
+	return decoder.int64()
+}
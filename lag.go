@@ -0,0 +1,85 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// PartitionLag shows how far a consumer is behind the end of a single topic-partition.
+// Offsets that are not known yet are InvalidOffset, and so are lags calculated from them.
+type PartitionLag struct {
+	// Offset of the next message to be written to the partition, as reported by the last fetch response.
+	HighWatermark int64
+
+	// Last offset committed by this consumer.
+	CommittedOffset int64
+
+	// Largest offset processed by this consumer.
+	ProcessedOffset int64
+
+	// Number of messages after the committed offset.
+	CommitLag int64
+
+	// Number of messages after the processed offset.
+	ProcessingLag int64
+}
+
+// Creates a new PartitionLag for given high watermark, committed and processed offsets.
+func NewPartitionLag(highWatermark int64, committedOffset int64, processedOffset int64) *PartitionLag {
+	return &PartitionLag{
+		HighWatermark:   highWatermark,
+		CommittedOffset: committedOffset,
+		ProcessedOffset: processedOffset,
+		CommitLag:       offsetLag(highWatermark, committedOffset),
+		ProcessingLag:   offsetLag(highWatermark, processedOffset),
+	}
+}
+
+func (l *PartitionLag) String() string {
+	return fmt.Sprintf("{HighWatermark: %d, CommitLag: %d, ProcessingLag: %d}", l.HighWatermark, l.CommitLag, l.ProcessingLag)
+}
+
+// Offsets point to the last consumed message while the high watermark points to the next message to be written.
+func offsetLag(highWatermark int64, offset int64) int64 {
+	if isOffsetInvalid(highWatermark) || isOffsetInvalid(offset) {
+		return InvalidOffset
+	}
+
+	lag := highWatermark - offset - 1
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// lagGauge is a read-only metrics.Gauge that calculates its value when it is read so that lag is always up to date.
+type lagGauge struct {
+	value func() int64
+}
+
+func (g *lagGauge) Snapshot() metrics.Gauge {
+	return metrics.GaugeSnapshot(g.Value())
+}
+
+func (g *lagGauge) Update(int64) {
+	panic("Update called on a lagGauge")
+}
+
+func (g *lagGauge) Value() int64 {
+	return g.value()
+}
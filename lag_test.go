@@ -0,0 +1,55 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+)
+
+func TestPartitionLag(t *testing.T) {
+	//high watermark points to the next message while offsets point to the last consumed one
+	lag := NewPartitionLag(100, 89, 94)
+	assert(t, lag.CommitLag, int64(10))
+	assert(t, lag.ProcessingLag, int64(5))
+
+	lag = NewPartitionLag(100, 99, 99)
+	assert(t, lag.CommitLag, int64(0))
+	assert(t, lag.ProcessingLag, int64(0))
+
+	//lag is unknown until something is fetched and consumed
+	lag = NewPartitionLag(InvalidOffset, 10, 10)
+	assert(t, lag.CommitLag, InvalidOffset)
+	lag = NewPartitionLag(100, InvalidOffset, 10)
+	assert(t, lag.CommitLag, InvalidOffset)
+	assert(t, lag.ProcessingLag, int64(89))
+
+	value := int64(5)
+	gauge := &lagGauge{func() int64 { return value }}
+	assert(t, gauge.Value(), int64(5))
+	snapshot := gauge.Snapshot()
+	value = 7
+	assert(t, gauge.Value(), int64(7))
+	assert(t, snapshot.Value(), int64(5))
+}
+
+func TestFetcherHighWatermarks(t *testing.T) {
+	manager := &consumerFetcherManager{highWatermarks: make(map[TopicAndPartition]int64)}
+	topicPartition := TopicAndPartition{"fakeTopic", 0}
+	assert(t, manager.highWatermark(topicPartition), InvalidOffset)
+
+	manager.updateHighWatermark(topicPartition, 42)
+	assert(t, manager.highWatermark(topicPartition), int64(42))
+}
@@ -18,7 +18,6 @@
 package main
 
 import (
-	"github.com/stealthly/go-kafka/producer"
 	"github.com/stealthly/go_kafka_client"
 	"time"
 	"fmt"
@@ -49,11 +48,16 @@ func main() {
 	go_kafka_client.CreateMultiplePartitionsTopic("192.168.86.5:2181", topic, 6)
 	time.Sleep(4 * time.Second)
 
-	p := producer.NewKafkaProducer(topic, []string{"192.168.86.10:9092"})
+	producerConfig := go_kafka_client.DefaultProducerConfig()
+	producerConfig.BrokerList = []string{"192.168.86.10:9092"}
+	p, err := go_kafka_client.NewKafkaProducer(producerConfig)
+	if err != nil {
+		panic(err)
+	}
 	defer p.Close()
 	go func() {
 		for {
-			if err := p.SendStringSync(fmt.Sprintf("message %d!", numMessage)); err != nil {
+			if err := p.Send(&go_kafka_client.ProducerMessage{Topic: topic, Value: []byte(fmt.Sprintf("message %d!", numMessage))}); err != nil {
 				panic(err)
 			}
 			numMessage++
@@ -100,6 +104,7 @@ func createConsumer(consumerid string) *go_kafka_client.Consumer {
 	config.WorkerRetryThreshold = 100
 	config.WorkerFailureCallback = FailedCallback
 	config.WorkerFailedAttemptCallback = FailedAttemptCallback
+	config.MetricsRegistry = metrics.DefaultRegistry
 
 	consumer := go_kafka_client.NewConsumer(config)
 	return consumer
@@ -33,6 +33,8 @@ type messageBuffer struct {
 	askNextBatch                   chan TopicAndPartition
 	disconnectChannelsForPartition chan TopicAndPartition
 	flush                          chan bool
+	seekOffset                     int64
+	generation                     int32
 }
 
 func newMessageBuffer(topicPartition TopicAndPartition, outputChannel chan []*Message, config *ConsumerConfig, askNextBatch chan TopicAndPartition, disconnectChannelsForPartition chan TopicAndPartition) *messageBuffer {
@@ -46,6 +48,7 @@ func newMessageBuffer(topicPartition TopicAndPartition, outputChannel chan []*Me
 		askNextBatch:                   askNextBatch,
 		disconnectChannelsForPartition: disconnectChannelsForPartition,
 		flush: make(chan bool),
+		seekOffset:                     InvalidOffset,
 	}
 
 	go buffer.autoFlush()
@@ -117,14 +120,23 @@ func (mb *messageBuffer) addBatch(data *TopicPartitionData) {
 		if topicPartition != mb.TopicPartition {
 			panic(fmt.Sprintf("%s got batch for wrong topic and partition: %s", mb, topicPartition))
 		}
+		if !isOffsetInvalid(mb.seekOffset) {
+			if data.FetchOffset != mb.seekOffset {
+				Infof(mb, "Dropping batch fetched from offset %d before seeking to offset %d", data.FetchOffset, mb.seekOffset)
+				fetchResponseBlock = nil
+			} else {
+				mb.seekOffset = InvalidOffset
+			}
+		}
 		if fetchResponseBlock != nil {
 			for _, message := range fetchResponseBlock.MsgSet.Messages {
 				mb.add(&Message{
-					Key:       message.Msg.Key,
-					Value:     message.Msg.Value,
-					Topic:     topicPartition.Topic,
-					Partition: topicPartition.Partition,
-					Offset:    message.Offset,
+					Key:        message.Msg.Key,
+					Value:      message.Msg.Value,
+					Topic:      topicPartition.Topic,
+					Partition:  topicPartition.Partition,
+					Offset:     message.Offset,
+					generation: mb.generation,
 				})
 			}
 		}
@@ -132,6 +144,26 @@ func (mb *messageBuffer) addBatch(data *TopicPartitionData) {
 	})
 }
 
+// Drops all buffered messages and batches that were fetched before seeking to a given offset.
+// Messages buffered afterwards belong to a given seek generation.
+func (mb *messageBuffer) seek(offset int64, generation int32) {
+	inLock(&mb.MessageLock, func() {
+		Infof(mb, "Seeking to offset %d, dropping %d buffered messages", offset, len(mb.Messages))
+		mb.Messages = make([]*Message, 0)
+		mb.seekOffset = offset
+		mb.generation = generation
+	})
+}
+
+// Moves a pending seek to a given offset if the seeked offset was out of range and was reset.
+func (mb *messageBuffer) resetSeek(offset int64) {
+	inLock(&mb.MessageLock, func() {
+		if !isOffsetInvalid(mb.seekOffset) {
+			mb.seekOffset = offset
+		}
+	})
+}
+
 func (mb *messageBuffer) add(msg *Message) {
 	Debugf(mb, "Added message: %s", msg)
 	mb.Messages = append(mb.Messages, msg)
@@ -0,0 +1,202 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ZookeeperOffsetStore implements OffsetStore interface and keeps offsets in Zookeeper using the same layout as Scala high-level consumer.
+type ZookeeperOffsetStore struct {
+	coordinator *ZookeeperCoordinator
+}
+
+// Creates a new ZookeeperOffsetStore that works through a given ZookeeperCoordinator.
+// The ZookeeperCoordinator should be connected before the store is used.
+func NewZookeeperOffsetStore(coordinator *ZookeeperCoordinator) *ZookeeperOffsetStore {
+	return &ZookeeperOffsetStore{
+		coordinator: coordinator,
+	}
+}
+
+// Gets the offset for a given TopicPartition and consumer group Group.
+// Returns InvalidOffset if there is no committed offset for a given TopicPartition and error on failure.
+func (s *ZookeeperOffsetStore) GetOffset(Group string, TopicPartition *TopicAndPartition) (int64, error) {
+	return s.coordinator.GetOffsetForTopicPartition(Group, TopicPartition)
+}
+
+// Commits offset Offset for topic and partition TopicPartition for consumer group Group.
+// Returns error if failed to commit offset.
+func (s *ZookeeperOffsetStore) CommitOffset(Group string, TopicPartition *TopicAndPartition, Offset int64) error {
+	return s.coordinator.CommitOffset(Group, TopicPartition, Offset)
+}
+
+// Does nothing as Zookeeper connection is owned by ZookeeperCoordinator.
+func (s *ZookeeperOffsetStore) Close() error {
+	return nil
+}
+
+// MemoryOffsetStore implements OffsetStore interface and keeps offsets in memory.
+// Offsets are lost once the process exits, so this is mostly useful for testing and for consumers that always start from AutoOffsetReset.
+type MemoryOffsetStore struct {
+	offsets map[string]map[TopicAndPartition]int64
+	lock    sync.RWMutex
+}
+
+// Creates a new empty MemoryOffsetStore.
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	return &MemoryOffsetStore{
+		offsets: make(map[string]map[TopicAndPartition]int64),
+	}
+}
+
+// Gets the offset for a given TopicPartition and consumer group Group.
+// Returns InvalidOffset if there is no committed offset for a given TopicPartition.
+func (s *MemoryOffsetStore) GetOffset(Group string, TopicPartition *TopicAndPartition) (int64, error) {
+	offset := InvalidOffset
+	inReadLock(&s.lock, func() {
+		if committed, exists := s.offsets[Group][*TopicPartition]; exists {
+			offset = committed
+		}
+	})
+	return offset, nil
+}
+
+// Commits offset Offset for topic and partition TopicPartition for consumer group Group.
+func (s *MemoryOffsetStore) CommitOffset(Group string, TopicPartition *TopicAndPartition, Offset int64) error {
+	inWriteLock(&s.lock, func() {
+		if _, exists := s.offsets[Group]; !exists {
+			s.offsets[Group] = make(map[TopicAndPartition]int64)
+		}
+		s.offsets[Group][*TopicPartition] = Offset
+	})
+	return nil
+}
+
+// Does nothing for MemoryOffsetStore.
+func (s *MemoryOffsetStore) Close() error {
+	return nil
+}
+
+// FileOffsetStore implements OffsetStore interface and keeps offsets in a local JSON file.
+// The whole file is rewritten on each commit, so commits survive a crash of the process at any point.
+// FileOffsetStore should not be shared between processes.
+type FileOffsetStore struct {
+	path    string
+	offsets map[string]map[string]map[int32]int64
+	lock    sync.Mutex
+}
+
+// Creates a new FileOffsetStore keeping offsets in a file located at Path.
+// Loads existing offsets if the file exists. Returns an error if the existing file could not be read.
+func NewFileOffsetStore(Path string) (*FileOffsetStore, error) {
+	store := &FileOffsetStore{
+		path:    Path,
+		offsets: make(map[string]map[string]map[int32]int64),
+	}
+
+	data, err := ioutil.ReadFile(Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.offsets); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *FileOffsetStore) String() string {
+	return s.path
+}
+
+// Gets the offset for a given TopicPartition and consumer group Group.
+// Returns InvalidOffset if there is no committed offset for a given TopicPartition.
+func (s *FileOffsetStore) GetOffset(Group string, TopicPartition *TopicAndPartition) (int64, error) {
+	offset := InvalidOffset
+	inLock(&s.lock, func() {
+		if committed, exists := s.offsets[Group][TopicPartition.Topic][TopicPartition.Partition]; exists {
+			offset = committed
+		}
+	})
+	return offset, nil
+}
+
+// Commits offset Offset for topic and partition TopicPartition for consumer group Group and flushes all offsets to file.
+// Returns error if failed to write the file.
+func (s *FileOffsetStore) CommitOffset(Group string, TopicPartition *TopicAndPartition, Offset int64) error {
+	var err error
+	inLock(&s.lock, func() {
+		if _, exists := s.offsets[Group]; !exists {
+			s.offsets[Group] = make(map[string]map[int32]int64)
+		}
+		if _, exists := s.offsets[Group][TopicPartition.Topic]; !exists {
+			s.offsets[Group][TopicPartition.Topic] = make(map[int32]int64)
+		}
+		s.offsets[Group][TopicPartition.Topic][TopicPartition.Partition] = Offset
+		err = s.flush()
+	})
+	return err
+}
+
+func (s *FileOffsetStore) flush() error {
+	data, err := json.Marshal(s.offsets)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Does nothing as FileOffsetStore flushes offsets on each commit.
+func (s *FileOffsetStore) Close() error {
+	return nil
+}
+
+// Creates an OffsetStore for a given ConsumerConfig according to its OffsetsStorage.
+// Config is expected to be validated, so the Coordinator is a ZookeeperCoordinator if offsets are kept in Zookeeper.
+func newDefaultOffsetStore(config *ConsumerConfig) OffsetStore {
+	if config.OffsetsStorage == KafkaOffsetStorage {
+		return NewKafkaOffsetStore(config)
+	}
+	return NewZookeeperOffsetStore(config.Coordinator.(*ZookeeperCoordinator))
+}
@@ -0,0 +1,100 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryOffsetStore(t *testing.T) {
+	testOffsetStore(t, NewMemoryOffsetStore())
+}
+
+func TestFileOffsetStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go_kafka_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "offsets.json")
+
+	store, err := NewFileOffsetStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOffsetStore(t, store)
+
+	//offsets should survive store re-creation
+	reopened, err := NewFileOffsetStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := reopened.GetOffset("group1", &TopicAndPartition{"topic1", 0})
+	assert(t, err, nil)
+	assert(t, offset, int64(15))
+
+	//corrupted file should not be silently ignored
+	ioutil.WriteFile(path, []byte("not a json"), 0644)
+	_, err = NewFileOffsetStore(path)
+	assertNot(t, err, nil)
+}
+
+func TestDefaultOffsetStore(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+
+	//validation does not create the store
+	config.Coordinator = NewZookeeperCoordinator(NewZookeeperConfig())
+	assert(t, config.Validate(), nil)
+	assert(t, config.OffsetStore, nil)
+	_, isZookeeperStore := newDefaultOffsetStore(config).(*ZookeeperOffsetStore)
+	assert(t, isZookeeperStore, true)
+
+	config.Coordinator = newMockZookeeperCoordinator()
+	assertNot(t, config.Validate(), nil)
+
+	config.OffsetsStorage = KafkaOffsetStorage
+	assert(t, config.Validate(), nil)
+	assert(t, config.OffsetStore, nil)
+	_, isKafkaStore := newDefaultOffsetStore(config).(*KafkaOffsetStore)
+	assert(t, isKafkaStore, true)
+}
+
+func testOffsetStore(t *testing.T, store OffsetStore) {
+	topicPartition := &TopicAndPartition{"topic1", 0}
+
+	offset, err := store.GetOffset("group1", topicPartition)
+	assert(t, err, nil)
+	assert(t, offset, InvalidOffset)
+
+	assert(t, store.CommitOffset("group1", topicPartition, 10), nil)
+	assert(t, store.CommitOffset("group1", topicPartition, 15), nil)
+	assert(t, store.CommitOffset("group2", topicPartition, 20), nil)
+
+	offset, _ = store.GetOffset("group1", topicPartition)
+	assert(t, offset, int64(15))
+	offset, _ = store.GetOffset("group2", topicPartition)
+	assert(t, offset, int64(20))
+	offset, _ = store.GetOffset("group1", &TopicAndPartition{"topic1", 1})
+	assert(t, offset, InvalidOffset)
+
+	assert(t, store.Close(), nil)
+}
@@ -16,9 +16,12 @@
 package go_kafka_client
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
+	"sync"
 )
 
 const (
@@ -41,22 +44,109 @@ const (
 	a) Every topic has the same number of streams within a consumer instance
 	b) The set of subscribed topics is identical for every consumer instance within the group. */
 	RoundRobinStrategy = "roundrobin"
+
+	/* The sticky partition assignor balances partitions of each topic between consumer threads the same way as the range
+	assignor does (every thread gets either floor or ceil of partitions/threads), but keeps partitions with their current
+	owners as long as the balance allows, so a membership change moves as few partitions as possible. Current owners are
+	read from the ConsumerCoordinator. Extra partitions go first to the threads that own more than floor of partitions/threads,
+	then to the other threads, both in consumer thread order. Each thread keeps its lowest partitions up to its share, and
+	partitions that have to move (those of departed consumers, unowned ones and those over a thread's share) are handed out
+	in partition order to the threads that are still below their share in consumer thread order.
+	Consumers compute the assignment at different times while others are already releasing partitions they lose and claiming
+	partitions they get. Neither changes which threads get extra partitions, which partitions threads keep or the order of
+	partitions that move, so every consumer computes the same assignment no matter how far the others have got.
+	For example, if C1 owns p0, p1, p2 and C2 joins, only p2 moves: p0 -> C1-0, p1 -> C1-0, p2 -> C2-0.
+	Consumers using this strategy always rebalance incrementally, as with EagerRebalance all partitions are released before
+	the assignment is computed. */
+	StickyStrategy = "sticky"
+
+	/* The weighted partition assignor splits partitions of each topic between consumers in proportion to ConsumerConfig.AssignmentWeight
+	they advertise in ConsumerInfo (consumers without a weight count as 1). Each consumer first gets floor(partitions * weight / total weight)
+	partitions; the remaining ones go one by one to consumers with the largest remainders of this division, ties broken by consumer id in
+	lexicographic order. A consumer's share is then split between its threads evenly (first threads in name order get the extra partitions)
+	and partitions are laid out in numeric order to consumers in id order and their threads in name order, so every consumer computes the
+	same assignment. For example, with consumers C1 of weight 2 and C2 of weight 1 with one stream each and partitions p0..p4:
+	p0 -> C1-0, p1 -> C1-0, p2 -> C1-0, p3 -> C2-0, p4 -> C2-0 (C1 gets 3 and C2 gets 1 + 1 extra, as their remainders 1/3 and 2/3 favour C2).
+	Requires ConsumerConfig.BlueGreenDeploymentEnabled to be false. */
+	WeightedStrategy = "weighted"
 )
 
-type assignStrategy func(*assignmentContext) map[TopicAndPartition]ConsumerThreadId
+// PartitionAssignor decides which partitions a consumer owns. Every consumer of a group runs the same PartitionAssignor with its own ConsumerId
+// and the same view of the group, so assignors must be deterministic: given the same context, consumers must agree on who owns each partition,
+// otherwise some partitions cannot be claimed until the next rebalance. Register custom assignors with RegisterPartitionAssignor and select them with ConsumerConfig.PartitionAssignmentStrategy.
+type PartitionAssignor interface {
+	/* Returns partitions that the consumer with context.ConsumerId should own, mapped to thread ids of this consumer (see AssignmentContext.MyTopicThreadIds).
+	Partitions mapped to threads of other consumers are ignored. */
+	Assign(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId
+}
+
+// PartitionAssignorFunc is an adapter to use an ordinary function as a PartitionAssignor.
+type PartitionAssignorFunc func(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId
+
+// Calls f(context).
+func (f PartitionAssignorFunc) Assign(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
+	return f(context)
+}
+
+var partitionAssignors = map[string]PartitionAssignor{
+	RangeStrategy:      PartitionAssignorFunc(rangeAssignor),
+	RoundRobinStrategy: PartitionAssignorFunc(roundRobinAssignor),
+	StickyStrategy:     PartitionAssignorFunc(stickyAssignor),
+	WeightedStrategy:   PartitionAssignorFunc(weightedAssignor),
+}
+var partitionAssignorsLock sync.RWMutex
+
+// Registers a PartitionAssignor under a given name, so that consumers with ConsumerConfig.PartitionAssignmentStrategy set to this name use it.
+// Should be called before consumers are created. Returns an error if the name is empty or already taken, e.g. by one of the built-in strategies.
+// Consumers using a registered assignor require ConsumerConfig.BlueGreenDeploymentEnabled to be false.
+func RegisterPartitionAssignor(name string, assignor PartitionAssignor) error {
+	if name == "" || assignor == nil {
+		return errors.New("Partition assignor name and assignor cannot be empty")
+	}
+
+	var err error
+	inWriteLock(&partitionAssignorsLock, func() {
+		if _, exists := partitionAssignors[name]; exists {
+			err = fmt.Errorf("Partition assignor %s is already registered", name)
+			return
+		}
+		partitionAssignors[name] = assignor
+	})
+	return err
+}
+
+func isPartitionAssignorRegistered(name string) bool {
+	registered := false
+	inReadLock(&partitionAssignorsLock, func() {
+		_, registered = partitionAssignors[name]
+	})
+	return registered
+}
+
+type assignStrategy func(*AssignmentContext) map[TopicAndPartition]ConsumerThreadId
 
 func newPartitionAssignor(strategy string) assignStrategy {
-	switch strategy {
-	case RoundRobinStrategy:
-		return roundRobinAssignor
-	case RangeStrategy:
-		return rangeAssignor
-	default:
+	var assignor PartitionAssignor
+	inReadLock(&partitionAssignorsLock, func() {
+		assignor = partitionAssignors[strategy]
+	})
+	if assignor == nil {
 		panic(fmt.Sprintf("Invalid partition assignment strategy: %s", strategy))
 	}
+
+	return func(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
+		ownershipDecision := assignor.Assign(context)
+		for topicPartition, consumerThreadId := range ownershipDecision {
+			if consumerThreadId.Consumer != context.ConsumerId {
+				Warnf(context.ConsumerId, "Partition assignor %s assigned %s to %s of another consumer, ignoring", strategy, &topicPartition, &consumerThreadId)
+				delete(ownershipDecision, topicPartition)
+			}
+		}
+		return ownershipDecision
+	}
 }
 
-func roundRobinAssignor(context *assignmentContext) map[TopicAndPartition]ConsumerThreadId {
+func roundRobinAssignor(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
 	ownershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
 
 	if len(context.ConsumersForTopic) > 0 {
@@ -100,7 +190,7 @@ func roundRobinAssignor(context *assignmentContext) map[TopicAndPartition]Consum
 	return ownershipDecision
 }
 
-func rangeAssignor(context *assignmentContext) map[TopicAndPartition]ConsumerThreadId {
+func rangeAssignor(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
 	ownershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
 
 	for topic, consumerThreadIds := range context.MyTopicThreadIds {
@@ -144,17 +234,204 @@ func rangeAssignor(context *assignmentContext) map[TopicAndPartition]ConsumerThr
 	return ownershipDecision
 }
 
-type assignmentContext struct {
-	ConsumerId          string
-	Group               string
-	MyTopicThreadIds    map[string][]ConsumerThreadId
+func stickyAssignor(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
+	ownershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
+
+	for topic := range context.MyTopicThreadIds {
+		consumerThreadIds := make([]ConsumerThreadId, len(context.ConsumersForTopic[topic]))
+		copy(consumerThreadIds, context.ConsumersForTopic[topic])
+		sort.Sort(byName(consumerThreadIds))
+		partitions := make([]int32, len(context.PartitionsForTopic[topic]))
+		copy(partitions, context.PartitionsForTopic[topic])
+		sort.Sort(intArray(partitions))
+		if len(consumerThreadIds) == 0 {
+			continue
+		}
+
+		//partitions each consumer thread currently owns
+		currentPartitions := make(map[ConsumerThreadId][]int32)
+		for _, consumerThreadId := range consumerThreadIds {
+			currentPartitions[consumerThreadId] = make([]int32, 0)
+		}
+		for _, partition := range partitions {
+			owner, owned := context.PartitionOwners[TopicAndPartition{topic, partition}]
+			if _, exists := currentPartitions[owner]; owned && exists {
+				currentPartitions[owner] = append(currentPartitions[owner], partition)
+			}
+		}
+
+		//threads already owning more than their share get the extra partitions first, so that fewer partitions move.
+		//Releasing and claiming partitions of this assignment does not change the order: a thread drops below this bound only if it does not get an extra partition
+		//and grows over it only if it does.
+		nPartsPerConsumer := len(partitions) / len(consumerThreadIds)
+		nConsumersWithExtraPart := len(partitions) % len(consumerThreadIds)
+		byExtraPartPriority := make([]ConsumerThreadId, 0, len(consumerThreadIds))
+		for _, consumerThreadId := range consumerThreadIds {
+			if len(currentPartitions[consumerThreadId]) > nPartsPerConsumer {
+				byExtraPartPriority = append(byExtraPartPriority, consumerThreadId)
+			}
+		}
+		for _, consumerThreadId := range consumerThreadIds {
+			if len(currentPartitions[consumerThreadId]) <= nPartsPerConsumer {
+				byExtraPartPriority = append(byExtraPartPriority, consumerThreadId)
+			}
+		}
+		quotas := make(map[ConsumerThreadId]int)
+		for i, consumerThreadId := range byExtraPartPriority {
+			quotas[consumerThreadId] = nPartsPerConsumer
+			if i < nConsumersWithExtraPart {
+				quotas[consumerThreadId]++
+			}
+		}
+
+		assignment := make(map[int32]ConsumerThreadId)
+		for _, consumerThreadId := range consumerThreadIds {
+			kept := currentPartitions[consumerThreadId]
+			if len(kept) > quotas[consumerThreadId] {
+				kept = kept[:quotas[consumerThreadId]]
+			}
+			for _, partition := range kept {
+				assignment[partition] = consumerThreadId
+			}
+			quotas[consumerThreadId] -= len(kept)
+		}
+
+		threadIndex := 0
+		for _, partition := range partitions {
+			if _, assigned := assignment[partition]; assigned {
+				continue
+			}
+			for quotas[consumerThreadIds[threadIndex]] == 0 {
+				threadIndex++
+			}
+			assignment[partition] = consumerThreadIds[threadIndex]
+			quotas[consumerThreadIds[threadIndex]]--
+		}
+
+		for partition, consumerThreadId := range assignment {
+			if consumerThreadId.Consumer == context.ConsumerId {
+				Infof(context.ConsumerId, "%s attempting to claim %s", consumerThreadId, &TopicAndPartition{Topic: topic, Partition: partition})
+				ownershipDecision[TopicAndPartition{Topic: topic, Partition: partition}] = consumerThreadId
+			}
+		}
+	}
+
+	return ownershipDecision
+}
+
+func weightedAssignor(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
+	ownershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
+
+	for topic := range context.MyTopicThreadIds {
+		consumerThreadIds := make([]ConsumerThreadId, len(context.ConsumersForTopic[topic]))
+		copy(consumerThreadIds, context.ConsumersForTopic[topic])
+		sort.Sort(byName(consumerThreadIds))
+		partitions := make([]int32, len(context.PartitionsForTopic[topic]))
+		copy(partitions, context.PartitionsForTopic[topic])
+		sort.Sort(intArray(partitions))
+
+		threadsOfConsumer := make(map[string][]ConsumerThreadId)
+		consumers := make([]string, 0)
+		for _, consumerThreadId := range consumerThreadIds {
+			if _, exists := threadsOfConsumer[consumerThreadId.Consumer]; !exists {
+				consumers = append(consumers, consumerThreadId.Consumer)
+			}
+			threadsOfConsumer[consumerThreadId.Consumer] = append(threadsOfConsumer[consumerThreadId.Consumer], consumerThreadId)
+		}
+		sort.Strings(consumers)
+		if len(consumers) == 0 {
+			continue
+		}
+
+		weights := make([]int, len(consumers))
+		totalWeight := 0
+		for i, consumer := range consumers {
+			weights[i] = 1
+			if info := context.ConsumerInfos[consumer]; info != nil && info.Weight > 0 {
+				weights[i] = info.Weight
+			}
+			totalWeight += weights[i]
+		}
+
+		//largest remainder method, ties broken by consumer id
+		shares := make([]int, len(consumers))
+		byRemainder := make([]int, len(consumers))
+		assigned := 0
+		for i := range consumers {
+			shares[i] = len(partitions) * weights[i] / totalWeight
+			assigned += shares[i]
+			byRemainder[i] = i
+		}
+		sort.Stable(byRemainderDesc{byRemainder, len(partitions), weights, totalWeight})
+		for i := 0; i < len(partitions)-assigned; i++ {
+			shares[byRemainder[i]]++
+		}
+
+		nextPartition := 0
+		for i, consumer := range consumers {
+			threads := threadsOfConsumer[consumer]
+			nPartsPerThread := shares[i] / len(threads)
+			nThreadsWithExtraPart := shares[i] % len(threads)
+			for j, consumerThreadId := range threads {
+				nParts := nPartsPerThread
+				if j < nThreadsWithExtraPart {
+					nParts++
+				}
+				for k := 0; k < nParts; k++ {
+					if consumerThreadId.Consumer == context.ConsumerId {
+						topicPartition := TopicAndPartition{Topic: topic, Partition: partitions[nextPartition]}
+						Infof(context.ConsumerId, "%s attempting to claim %s", consumerThreadId, &topicPartition)
+						ownershipDecision[topicPartition] = consumerThreadId
+					}
+					nextPartition++
+				}
+			}
+		}
+	}
+
+	return ownershipDecision
+}
+
+type byRemainderDesc struct {
+	consumers   []int
+	partitions  int
+	weights     []int
+	totalWeight int
+}
+
+func (a byRemainderDesc) Len() int { return len(a.consumers) }
+func (a byRemainderDesc) Swap(i, j int) {
+	a.consumers[i], a.consumers[j] = a.consumers[j], a.consumers[i]
+}
+func (a byRemainderDesc) Less(i, j int) bool {
+	return a.partitions*a.weights[a.consumers[i]]%a.totalWeight > a.partitions*a.weights[a.consumers[j]]%a.totalWeight
+}
+
+// AssignmentContext describes the consumer group a PartitionAssignor assigns partitions for, as seen by a single consumer.
+type AssignmentContext struct {
+	// Id of the consumer partitions are assigned to.
+	ConsumerId string
+	// Consumer group id.
+	Group string
+	// Thread ids of this consumer for each topic it consumes.
+	MyTopicThreadIds map[string][]ConsumerThreadId
+	// Subscription of this consumer, either static or wildcard.
 	MyTopicToNumStreams TopicsToNumStreams
-	PartitionsForTopic  map[string][]int32
-	ConsumersForTopic   map[string][]ConsumerThreadId
-	Consumers           []string
+	// Partition ids of each topic this consumer consumes.
+	PartitionsForTopic map[string][]int32
+	// Thread ids of all consumers in the group for each topic.
+	ConsumersForTopic map[string][]ConsumerThreadId
+	// Ids of all consumers in the group.
+	Consumers []string
+	// Consumer threads that currently own partitions of topics this consumer consumes. Partitions nobody owns are not in the map.
+	// Owners are read while other consumers may be releasing and claiming partitions in the same rebalance, so an assignor using them
+	// has to compute the same assignment from any such state (see StickyStrategy). Empty for consumers started with StartStaticPartitions.
+	PartitionOwners map[TopicAndPartition]ConsumerThreadId
+	// Registration info of consumers in the group by consumer id, including their weights and tags. Empty for consumers started with StartStaticPartitions.
+	ConsumerInfos map[string]*ConsumerInfo
 }
 
-func newAssignmentContext(group string, consumerId string, excludeInternalTopics bool, coordinator ConsumerCoordinator) (*assignmentContext, error) {
+func newAssignmentContext(group string, consumerId string, excludeInternalTopics bool, coordinator ConsumerCoordinator) (*AssignmentContext, error) {
 	topicCount, _ := NewTopicsToNumStreams(group, consumerId, coordinator, excludeInternalTopics)
 	myTopicThreadIds := topicCount.GetConsumerThreadIdsPerTopic()
 	topics := make([]string, 0)
@@ -164,8 +441,16 @@ func newAssignmentContext(group string, consumerId string, excludeInternalTopics
 	partitionsForTopic, _ := coordinator.GetPartitionsForTopics(topics)
 	consumersForTopic, _ := coordinator.GetConsumersPerTopic(group, excludeInternalTopics)
 	consumers, _ := coordinator.GetConsumersInGroup(group)
+	partitionOwners, err := coordinator.GetPartitionOwners(group, topics)
+	if err != nil {
+		return nil, err
+	}
+	consumerInfos, err := getConsumerInfos(group, consumers, coordinator)
+	if err != nil {
+		return nil, err
+	}
 
-	return &assignmentContext{
+	return &AssignmentContext{
 		ConsumerId:          consumerId,
 		Group:               group,
 		MyTopicThreadIds:    myTopicThreadIds,
@@ -173,10 +458,24 @@ func newAssignmentContext(group string, consumerId string, excludeInternalTopics
 		PartitionsForTopic:  partitionsForTopic,
 		ConsumersForTopic:   consumersForTopic,
 		Consumers:           consumers,
+		PartitionOwners:     partitionOwners,
+		ConsumerInfos:       consumerInfos,
 	}, nil
 }
 
-func newStaticAssignmentContext(group string, consumerId string, consumersInGroup []string, topicCount TopicsToNumStreams, topicPartitionMap map[string][]int32) *assignmentContext {
+func getConsumerInfos(group string, consumers []string, coordinator ConsumerCoordinator) (map[string]*ConsumerInfo, error) {
+	consumerInfos := make(map[string]*ConsumerInfo)
+	for _, consumer := range consumers {
+		consumerInfo, err := coordinator.GetConsumerInfo(consumer, group)
+		if err != nil {
+			return nil, err
+		}
+		consumerInfos[consumer] = consumerInfo
+	}
+	return consumerInfos, nil
+}
+
+func newStaticAssignmentContext(group string, consumerId string, consumersInGroup []string, topicCount TopicsToNumStreams, topicPartitionMap map[string][]int32) *AssignmentContext {
 	myTopicThreadIds := topicCount.GetConsumerThreadIdsPerTopic()
 	consumersForTopic := make(map[string][]ConsumerThreadId)
 	for topic := range topicPartitionMap {
@@ -190,7 +489,7 @@ func newStaticAssignmentContext(group string, consumerId string, consumersInGrou
 		}
 	}
 
-	return &assignmentContext{
+	return &AssignmentContext{
 		ConsumerId:          consumerId,
 		Group:               group,
 		MyTopicThreadIds:    myTopicThreadIds,
@@ -39,7 +39,7 @@ var (
 func TestRoundRobinAssignor(t *testing.T) {
 	//basic scenario
 	assignor := newPartitionAssignor("roundrobin")
-	context := &assignmentContext{
+	context := &AssignmentContext{
 		Group:              "group",
 		PartitionsForTopic: partitionsForTopic,
 		ConsumersForTopic:  consumersForTopic,
@@ -97,7 +97,7 @@ func TestRoundRobinAssignor(t *testing.T) {
 func TestRangeAssignor(t *testing.T) {
 	//basic scenario
 	assignor := newPartitionAssignor("range")
-	context := &assignmentContext{
+	context := &AssignmentContext{
 		Group:              "group",
 		PartitionsForTopic: partitionsForTopic,
 		ConsumersForTopic:  consumersForTopic,
@@ -124,3 +124,273 @@ func TestRangeAssignor(t *testing.T) {
 
 	assert(t, totalDecisions, totalPartitions)
 }
+
+func TestStickyAssignor(t *testing.T) {
+	assignor := newPartitionAssignor(StickyStrategy)
+	assignAll := func(consumersInGroup []string, threadIds []ConsumerThreadId, owners map[TopicAndPartition]ConsumerThreadId) map[TopicAndPartition]ConsumerThreadId {
+		assignment := make(map[TopicAndPartition]ConsumerThreadId)
+		for _, consumer := range consumersInGroup {
+			context := &AssignmentContext{
+				ConsumerId:         consumer,
+				Group:              "group",
+				PartitionsForTopic: partitionsForTopic,
+				ConsumersForTopic:  map[string][]ConsumerThreadId{"topic1": threadIds},
+				Consumers:          consumersInGroup,
+				PartitionOwners:    owners,
+				MyTopicThreadIds: map[string][]ConsumerThreadId{
+					"topic1": []ConsumerThreadId{ConsumerThreadId{consumer, 0}, ConsumerThreadId{consumer, 1}},
+				},
+			}
+			for topicPartition, consumerThreadId := range assignor(context) {
+				if _, exists := assignment[topicPartition]; exists {
+					t.Errorf("Partition %v is assigned twice", topicPartition)
+				}
+				assignment[topicPartition] = consumerThreadId
+			}
+		}
+		assert(t, len(assignment), totalPartitions)
+		return assignment
+	}
+	//consumers compute the assignment while others release partitions they lose and claim partitions they get,
+	//so every moved partition may still be with its old owner, with nobody or already with its new owner
+	assertSameWhileMoving := func(consumersInGroup []string, threadIds []ConsumerThreadId, before map[TopicAndPartition]ConsumerThreadId, after map[TopicAndPartition]ConsumerThreadId) {
+		moved := make([]TopicAndPartition, 0)
+		for topicPartition, consumerThreadId := range after {
+			if before[topicPartition] != consumerThreadId {
+				moved = append(moved, topicPartition)
+			}
+		}
+		assertNot(t, len(moved), 0)
+		states := 1
+		for _ = range moved {
+			states *= 3
+		}
+		for state := 0; state < states; state++ {
+			owners := make(map[TopicAndPartition]ConsumerThreadId)
+			for topicPartition, consumerThreadId := range before {
+				owners[topicPartition] = consumerThreadId
+			}
+			for i, code := 0, state; i < len(moved); i, code = i+1, code/3 {
+				switch code % 3 {
+				case 1:
+					delete(owners, moved[i])
+				case 2:
+					owners[moved[i]] = after[moved[i]]
+				}
+			}
+			assert(t, assignAll(consumersInGroup, threadIds, owners), after)
+		}
+	}
+
+	//nothing is owned yet
+	assignment := assignAll(consumers[:1], consumerThreadIds[:2], nil)
+	assert(t, assignment, map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[1],
+	})
+
+	//a joining consumer takes over only as many partitions as it needs
+	previous := assignment
+	assignment = assignAll(consumers, consumerThreadIds, assignment)
+	assert(t, assignment, map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[2],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[3],
+	})
+	assertSameWhileMoving(consumers, consumerThreadIds, previous, assignment)
+
+	//partitions of a leaving consumer are spread without moving any other partition
+	previous = assignment
+	assignment = assignAll(consumers[:1], consumerThreadIds[:2], assignment)
+	assert(t, assignment, map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[1],
+	})
+	assertSameWhileMoving(consumers[:1], consumerThreadIds[:2], previous, assignment)
+
+	//uneven ownership left by an earlier rebalance is evened out the same way from any state
+	previous = map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[3],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[3],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[3],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+	}
+	assignment = assignAll(consumers, consumerThreadIds, previous)
+	assert(t, assignment, map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[3],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[3],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[2],
+	})
+	assertSameWhileMoving(consumers, consumerThreadIds, previous, assignment)
+
+	owner, err := parseConsumerThreadId("consumer-host-1-2")
+	assert(t, err, nil)
+	assert(t, owner, ConsumerThreadId{"consumer-host-1", 2})
+	_, err = parseConsumerThreadId("consumer")
+	assertNot(t, err, nil)
+
+	//sticky strategy works with blue-green deployment, which is enabled by default, while round-robin and weighted strategies do not
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+	config.PartitionAssignmentStrategy = StickyStrategy
+	assert(t, config.Validate(), nil)
+
+	//sticky strategy rebalances incrementally even with the default eager protocol
+	assert(t, config.RebalanceProtocol, EagerRebalance)
+	assert(t, (&Consumer{config: config}).rebalancesIncrementally(), true)
+	config.PartitionAssignmentStrategy = RangeStrategy
+	assert(t, (&Consumer{config: config}).rebalancesIncrementally(), false)
+	config.RebalanceProtocol = IncrementalRebalance
+	assert(t, (&Consumer{config: config}).rebalancesIncrementally(), true)
+	config.RebalanceProtocol = EagerRebalance
+
+	config.PartitionAssignmentStrategy = RangeStrategy
+	assert(t, config.Validate(), nil)
+	for _, strategy := range []string{RoundRobinStrategy, WeightedStrategy} {
+		config.PartitionAssignmentStrategy = strategy
+		config.BlueGreenDeploymentEnabled = true
+		assertNot(t, config.Validate(), nil)
+		config.BlueGreenDeploymentEnabled = false
+		assert(t, config.Validate(), nil)
+	}
+}
+
+func TestWeightedAssignor(t *testing.T) {
+	assignor := newPartitionAssignor(WeightedStrategy)
+	assignAll := func(consumerInfos map[string]*ConsumerInfo) map[TopicAndPartition]ConsumerThreadId {
+		assignment := make(map[TopicAndPartition]ConsumerThreadId)
+		for _, consumer := range consumers {
+			context := &AssignmentContext{
+				ConsumerId:         consumer,
+				Group:              "group",
+				PartitionsForTopic: partitionsForTopic,
+				ConsumersForTopic:  consumersForTopic,
+				Consumers:          consumers,
+				ConsumerInfos:      consumerInfos,
+				MyTopicThreadIds: map[string][]ConsumerThreadId{
+					"topic1": []ConsumerThreadId{ConsumerThreadId{consumer, 0}, ConsumerThreadId{consumer, 1}},
+				},
+			}
+			for topicPartition, consumerThreadId := range assignor(context) {
+				if _, exists := assignment[topicPartition]; exists {
+					t.Errorf("Partition %v is assigned twice", topicPartition)
+				}
+				assignment[topicPartition] = consumerThreadId
+			}
+		}
+		assert(t, len(assignment), totalPartitions)
+		return assignment
+	}
+
+	//the first consumer has three times the capacity of the second one
+	assert(t, assignAll(map[string]*ConsumerInfo{
+		"consumerid1": &ConsumerInfo{Weight: 3},
+		"consumerid2": &ConsumerInfo{Weight: 1},
+	}), map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[2],
+	})
+
+	//the second consumer has the larger remainder and gets the leftover partition
+	assert(t, assignAll(map[string]*ConsumerInfo{
+		"consumerid1": &ConsumerInfo{Weight: 1},
+		"consumerid2": &ConsumerInfo{Weight: 2},
+	}), map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[2],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[2],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[3],
+	})
+
+	//equal remainders are broken by consumer id, consumers without weight count as 1
+	assert(t, assignAll(map[string]*ConsumerInfo{
+		"consumerid1": &ConsumerInfo{},
+	}), map[TopicAndPartition]ConsumerThreadId{
+		TopicAndPartition{"topic1", 0}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 1}: consumerThreadIds[0],
+		TopicAndPartition{"topic1", 2}: consumerThreadIds[1],
+		TopicAndPartition{"topic1", 3}: consumerThreadIds[2],
+		TopicAndPartition{"topic1", 4}: consumerThreadIds[3],
+	})
+
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+	config.PartitionAssignmentStrategy = WeightedStrategy
+	config.BlueGreenDeploymentEnabled = false
+	assert(t, config.Validate(), nil)
+	config.AssignmentWeight = 0
+	assertNot(t, config.Validate(), nil)
+}
+
+func TestRegisterPartitionAssignor(t *testing.T) {
+	//pins the last partition to the first consumer and spreads the rest with the range assignor
+	pinningAssignor := PartitionAssignorFunc(func(context *AssignmentContext) map[TopicAndPartition]ConsumerThreadId {
+		ownershipDecision := make(map[TopicAndPartition]ConsumerThreadId)
+		for topic, partitions := range context.PartitionsForTopic {
+			pinned := TopicAndPartition{topic, partitions[len(partitions)-1]}
+			rest := *context
+			rest.PartitionsForTopic = map[string][]int32{topic: partitions[:len(partitions)-1]}
+			for topicPartition, consumerThreadId := range rangeAssignor(&rest) {
+				ownershipDecision[topicPartition] = consumerThreadId
+			}
+			ownershipDecision[pinned] = context.ConsumersForTopic[topic][0]
+		}
+		return ownershipDecision
+	})
+	assert(t, RegisterPartitionAssignor("test-pinning", pinningAssignor), nil)
+	assertNot(t, RegisterPartitionAssignor("test-pinning", pinningAssignor), nil)
+	assertNot(t, RegisterPartitionAssignor(RangeStrategy, pinningAssignor), nil)
+	assertNot(t, RegisterPartitionAssignor("", pinningAssignor), nil)
+
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+	config.PartitionAssignmentStrategy = "test-pinning"
+	//custom strategies may not assign each topic on its own, so they cannot be used with blue-green deployment
+	assertNot(t, config.Validate(), nil)
+	config.BlueGreenDeploymentEnabled = false
+	assert(t, config.Validate(), nil)
+	config.PartitionAssignmentStrategy = "test-unknown"
+	assertNot(t, config.Validate(), nil)
+
+	assignor := newPartitionAssignor("test-pinning")
+	context := &AssignmentContext{
+		Group:              "group",
+		PartitionsForTopic: partitionsForTopic,
+		ConsumersForTopic:  consumersForTopic,
+		Consumers:          consumers,
+	}
+	assignment := make(map[TopicAndPartition]ConsumerThreadId)
+	for _, consumer := range consumers {
+		context.ConsumerId = consumer
+		context.MyTopicThreadIds = map[string][]ConsumerThreadId{
+			"topic1": []ConsumerThreadId{ConsumerThreadId{consumer, 0}, ConsumerThreadId{consumer, 1}},
+		}
+		//partitions assigned to other consumers are dropped
+		for topicPartition, consumerThreadId := range assignor(context) {
+			assert(t, consumerThreadId.Consumer, consumer)
+			assignment[topicPartition] = consumerThreadId
+		}
+	}
+	assert(t, len(assignment), totalPartitions)
+	assert(t, assignment[TopicAndPartition{"topic1", 4}], consumerThreadIds[0])
+}
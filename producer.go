@@ -0,0 +1,599 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"hash/crc32"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Producer is an interface that is used to send messages to Kafka.
+type Producer interface {
+	/* Sends a given message to Kafka and blocks until it is acknowledged according to the producer configuration.
+	Returns an error if the message could not be sent. */
+	Send(message *ProducerMessage) error
+
+	/* Queues a given message to be sent to Kafka and returns immediately.
+	The callback, if not nil, is called with the delivery report once the message is acknowledged or failed to be sent. */
+	SendAsync(message *ProducerMessage, callback DeliveryCallback)
+
+	/* Sends all queued messages and closes all connections to Kafka brokers. */
+	Close() error
+}
+
+// Single message that is sent to Kafka with a Producer.
+type ProducerMessage struct {
+	// Topic to send this message to.
+	Topic string
+
+	// Partition key. Passed to Partitioner to choose a partition for this message.
+	Key []byte
+
+	// Message value.
+	Value []byte
+
+	// Value to encode into Key with ProducerConfig.KeyEncoder. Ignored if KeyEncoder is not set.
+	KeyObject interface{}
+
+	// Value to encode into Value with ProducerConfig.ValueEncoder. Ignored if ValueEncoder is not set.
+	ValueObject interface{}
+
+	// Partition this message was sent to. Set by Producer.
+	Partition int32
+
+	// Offset of this message. Set by Producer once the message is delivered, InvalidOffset if producer does not wait for acknowledgements.
+	Offset int64
+}
+
+func (m *ProducerMessage) String() string {
+	return fmt.Sprintf("{Topic: %s, Key: %s}", m.Topic, m.Key)
+}
+
+// A callback that is triggered when a message sent with Producer.SendAsync is delivered (err is nil) or failed to be sent after all retries.
+// Callbacks are called from the producer goroutine, so they should return quickly.
+type DeliveryCallback func(message *ProducerMessage, err error)
+
+// Encoder is an interface that is used to turn typed message keys and values into bytes before they are sent.
+// Encoders are called concurrently by different senders, so implementations should be thread-safe.
+type Encoder interface {
+	/* Encodes a given value into bytes. Returns an error if the value cannot be encoded. */
+	Encode(value interface{}) ([]byte, error)
+}
+
+// Chooses a partition for a given message. Returns an index of a partition in range [0, numPartitions).
+type Partitioner func(message *ProducerMessage, numPartitions int32) int32
+
+// Creates a Partitioner that sends messages with the same key to the same partition and spreads messages without key between partitions in round-robin manner.
+func NewHashPartitioner() Partitioner {
+	roundRobin := NewRoundRobinPartitioner()
+	return func(message *ProducerMessage, numPartitions int32) int32 {
+		if len(message.Key) == 0 {
+			return roundRobin(message, numPartitions)
+		}
+
+		hash := fnv.New32a()
+		hash.Write(message.Key)
+		return int32(hash.Sum32() % uint32(numPartitions))
+	}
+}
+
+// Creates a Partitioner that spreads messages between partitions in round-robin manner regardless of their keys.
+func NewRoundRobinPartitioner() Partitioner {
+	var counter uint32
+	var lock sync.Mutex
+	return func(_ *ProducerMessage, numPartitions int32) int32 {
+		var partition int32
+		inLock(&lock, func() {
+			partition = int32(counter % uint32(numPartitions))
+			counter++
+		})
+		return partition
+	}
+}
+
+// Creates a Partitioner that sends each message to a random partition.
+func NewRandomPartitioner() Partitioner {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var lock sync.Mutex
+	return func(_ *ProducerMessage, numPartitions int32) int32 {
+		var partition int32
+		inLock(&lock, func() {
+			partition = random.Int31n(numPartitions)
+		})
+		return partition
+	}
+}
+
+// KafkaProducer is a Producer implementation that talks to Kafka brokers directly.
+// It accumulates messages into per-partition batches, sends a single produce request to each leader broker per flush, optionally compressing batches,
+// and resends failed messages after refreshing topic metadata.
+// Messages for the same partition are delivered in order unless they are retried.
+type KafkaProducer struct {
+	config     *ProducerConfig
+	codec      sarama.CompressionCodec
+	input      chan *producerRecord
+	closing    chan bool
+	closed     bool
+	closeLock  sync.RWMutex
+	inFlight   sync.WaitGroup
+	partitions map[string][]int32
+	leaders    map[TopicAndPartition]string
+	brokers    map[string]*sarama.Broker
+	lock       sync.Mutex
+}
+
+type producerRecord struct {
+	message     *ProducerMessage
+	callback    DeliveryCallback
+	partitioned bool
+	retries     int
+}
+
+// Creates a new KafkaProducer with a given ProducerConfig and starts its batching routine. Connections to brokers are established on first use.
+// Returns an error if the ProducerConfig is invalid.
+func NewKafkaProducer(config *ProducerConfig) (*KafkaProducer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	codec := sarama.CompressionNone
+	switch config.CompressionCodec {
+	case GzipCompression:
+		codec = sarama.CompressionGZIP
+	case SnappyCompression:
+		codec = sarama.CompressionSnappy
+	}
+
+	producer := &KafkaProducer{
+		config:     config,
+		codec:      codec,
+		input:      make(chan *producerRecord, config.QueuedMaxMessages),
+		closing:    make(chan bool),
+		partitions: make(map[string][]int32),
+		leaders:    make(map[TopicAndPartition]string),
+		brokers:    make(map[string]*sarama.Broker),
+	}
+	go producer.batch()
+
+	return producer, nil
+}
+
+func (p *KafkaProducer) String() string {
+	return fmt.Sprintf("%s-producer", p.config.Clientid)
+}
+
+// Sends a given message and blocks until it is delivered or failed to be sent after ProducerConfig.SendMaxRetries retries.
+// Partition and Offset of the message are set once this method returns without error.
+func (p *KafkaProducer) Send(message *ProducerMessage) error {
+	delivered := make(chan error, 1)
+	p.SendAsync(message, func(_ *ProducerMessage, err error) {
+		delivered <- err
+	})
+	return <-delivered
+}
+
+// Queues a given message to be sent with the next batch. Blocks only if ProducerConfig.QueuedMaxMessages messages are already queued.
+// The callback, if not nil, gets the message with Partition and Offset set or an error if the message failed to be sent after ProducerConfig.SendMaxRetries retries.
+func (p *KafkaProducer) SendAsync(message *ProducerMessage, callback DeliveryCallback) {
+	closed := false
+	inReadLock(&p.closeLock, func() {
+		closed = p.closed
+		if !closed {
+			p.inFlight.Add(1)
+		}
+	})
+	if closed {
+		if callback != nil {
+			callback(message, errors.New("Producer is closed"))
+		}
+		return
+	}
+
+	if err := p.encode(message); err != nil {
+		Warnf(p, "Failed to encode message %s: %s", message, err)
+		if callback != nil {
+			callback(message, err)
+		}
+		p.inFlight.Done()
+		return
+	}
+
+	p.input <- &producerRecord{message: message, callback: callback}
+}
+
+// Encodes KeyObject and ValueObject of a given message with configured encoders.
+func (p *KafkaProducer) encode(message *ProducerMessage) error {
+	if p.config.KeyEncoder != nil && message.KeyObject != nil {
+		key, err := p.config.KeyEncoder.Encode(message.KeyObject)
+		if err != nil {
+			return fmt.Errorf("key: %s", err)
+		}
+		message.Key = key
+	}
+
+	if p.config.ValueEncoder != nil && message.ValueObject != nil {
+		value, err := p.config.ValueEncoder.Encode(message.ValueObject)
+		if err != nil {
+			return fmt.Errorf("value: %s", err)
+		}
+		message.Value = value
+	}
+
+	return nil
+}
+
+func (p *KafkaProducer) batch() {
+	pending := make(map[TopicAndPartition][]*producerRecord)
+	var flushTimeout <-chan time.Time
+	for {
+		select {
+		case record := <-p.input:
+			{
+				if !p.assignPartition(record) {
+					continue
+				}
+
+				topicPartition := TopicAndPartition{record.message.Topic, record.message.Partition}
+				pending[topicPartition] = append(pending[topicPartition], record)
+				if len(pending[topicPartition]) >= p.config.BatchSize {
+					p.flush(pending)
+					pending = make(map[TopicAndPartition][]*producerRecord)
+					flushTimeout = nil
+				} else if flushTimeout == nil {
+					flushTimeout = time.After(p.config.BatchTimeout)
+				}
+			}
+		case <-flushTimeout:
+			{
+				p.flush(pending)
+				pending = make(map[TopicAndPartition][]*producerRecord)
+				flushTimeout = nil
+			}
+		case <-p.closing:
+			return
+		}
+	}
+}
+
+func (p *KafkaProducer) assignPartition(record *producerRecord) bool {
+	if record.partitioned {
+		return true
+	}
+
+	partitions, err := p.topicPartitions(record.message.Topic)
+	if err != nil {
+		p.retryOrFail(record, err)
+		return false
+	}
+
+	index := p.config.Partitioner(record.message, int32(len(partitions)))
+	if index < 0 || int(index) >= len(partitions) {
+		p.deliver(record, fmt.Errorf("Partitioner returned invalid partition index %d for topic %s with %d partitions", index, record.message.Topic, len(partitions)))
+		return false
+	}
+	record.message.Partition = partitions[index]
+	record.partitioned = true
+
+	return true
+}
+
+func (p *KafkaProducer) flush(pending map[TopicAndPartition][]*producerRecord) {
+	requests := make(map[*sarama.Broker]map[TopicAndPartition][]*producerRecord)
+	for topicPartition, records := range pending {
+		broker, err := p.leader(topicPartition.Topic, topicPartition.Partition)
+		if err != nil {
+			for _, record := range records {
+				p.retryOrFail(record, err)
+			}
+			continue
+		}
+
+		if _, exists := requests[broker]; !exists {
+			requests[broker] = make(map[TopicAndPartition][]*producerRecord)
+		}
+		requests[broker][topicPartition] = records
+	}
+
+	for broker, batches := range requests {
+		p.produce(broker, batches)
+	}
+}
+
+func (p *KafkaProducer) produce(broker *sarama.Broker, batches map[TopicAndPartition][]*producerRecord) {
+	request := &sarama.ProduceRequest{
+		RequiredAcks: sarama.RequiredAcks(p.config.RequiredAcks),
+		Timeout:      int32(p.config.AckTimeout / time.Millisecond),
+	}
+	for topicPartition, records := range batches {
+		if p.codec == sarama.CompressionNone {
+			for _, record := range records {
+				request.AddMessage(topicPartition.Topic, topicPartition.Partition, &sarama.Message{Codec: sarama.CompressionNone, Key: record.message.Key, Value: record.message.Value})
+			}
+		} else {
+			request.AddMessage(topicPartition.Topic, topicPartition.Partition, &sarama.Message{Codec: p.codec, Value: encodeMessageSet(records)})
+		}
+	}
+
+	response, err := broker.Produce(p.config.Clientid, request)
+	if err != nil {
+		Infof(p, "Failed to send produce request to broker %s: %s", broker.Addr(), err)
+		p.disconnect(broker)
+		for _, records := range batches {
+			for _, record := range records {
+				p.retryOrFail(record, err)
+			}
+		}
+		return
+	}
+
+	for topicPartition, records := range batches {
+		if request.RequiredAcks == sarama.NoResponse {
+			for _, record := range records {
+				record.message.Offset = InvalidOffset
+				p.deliver(record, nil)
+			}
+			continue
+		}
+
+		var err error
+		block := response.GetBlock(topicPartition.Topic, topicPartition.Partition)
+		if block == nil {
+			err = sarama.IncompleteResponse
+		} else if block.Err != sarama.NoError {
+			err = block.Err
+		}
+		for i, record := range records {
+			if err != nil {
+				p.retryOrFail(record, err)
+			} else {
+				record.message.Offset = block.Offset + int64(i)
+				p.deliver(record, nil)
+			}
+		}
+	}
+}
+
+func (p *KafkaProducer) retryOrFail(record *producerRecord, err error) {
+	if record.retries >= p.config.SendMaxRetries {
+		p.deliver(record, err)
+		return
+	}
+
+	Infof(p, "Failed to send message %s: %s. Retrying...", record.message, err)
+	record.retries++
+	p.invalidateMetadata(record.message.Topic)
+	go func() {
+		time.Sleep(p.config.RetryBackoff)
+		p.input <- record
+	}()
+}
+
+func (p *KafkaProducer) deliver(record *producerRecord, err error) {
+	if err != nil {
+		Warnf(p, "Failed to send message %s after %d retries: %s", record.message, record.retries, err)
+	}
+	if record.callback != nil {
+		record.callback(record.message, err)
+	}
+	p.inFlight.Done()
+}
+
+func (p *KafkaProducer) topicPartitions(topic string) ([]int32, error) {
+	var partitions []int32
+	var err error
+	inLock(&p.lock, func() {
+		if _, exists := p.partitions[topic]; !exists {
+			err = p.refreshMetadata(topic)
+		}
+		partitions = p.partitions[topic]
+	})
+	if err == nil && len(partitions) == 0 {
+		err = fmt.Errorf("No partitions available for topic %s", topic)
+	}
+
+	return partitions, err
+}
+
+func (p *KafkaProducer) leader(topic string, partition int32) (*sarama.Broker, error) {
+	var broker *sarama.Broker
+	var err error
+	inLock(&p.lock, func() {
+		addr, exists := p.leaders[TopicAndPartition{topic, partition}]
+		if !exists {
+			if err = p.refreshMetadata(topic); err != nil {
+				return
+			}
+			addr, exists = p.leaders[TopicAndPartition{topic, partition}]
+		}
+		if !exists {
+			err = fmt.Errorf("No leader available for topic %s and partition %d", topic, partition)
+			return
+		}
+
+		broker, exists = p.brokers[addr]
+		if !exists {
+			broker, err = p.connect(addr)
+			if err == nil {
+				p.brokers[addr] = broker
+			}
+		}
+	})
+
+	return broker, err
+}
+
+func (p *KafkaProducer) brokerList() ([]string, error) {
+	if len(p.config.BrokerList) > 0 {
+		return p.config.BrokerList, nil
+	}
+
+	brokers, err := p.config.Coordinator.GetAllBrokers()
+	if err != nil {
+		return nil, err
+	}
+	brokerList := make([]string, 0, len(brokers))
+	for _, broker := range brokers {
+		brokerList = append(brokerList, fmt.Sprintf("%s:%d", broker.Host, broker.Port))
+	}
+	return brokerList, nil
+}
+
+// Should be called under lock.
+func (p *KafkaProducer) refreshMetadata(topic string) error {
+	brokerList, err := p.brokerList()
+	if err != nil {
+		return err
+	}
+
+	err = errors.New("No brokers available to fetch topic metadata")
+	for _, addr := range brokerList {
+		broker, connectErr := p.connect(addr)
+		if connectErr != nil {
+			Warnf(p, "Could not connect to broker %s to fetch topic metadata: %s", addr, connectErr)
+			err = connectErr
+			continue
+		}
+
+		response, requestErr := broker.GetMetadata(p.config.Clientid, &sarama.MetadataRequest{Topics: []string{topic}})
+		broker.Close()
+		if requestErr != nil {
+			Warnf(p, "Could not fetch topic metadata from broker %s: %s", addr, requestErr)
+			err = requestErr
+			continue
+		}
+
+		brokers := make(map[int32]string)
+		for _, broker := range response.Brokers {
+			brokers[broker.ID()] = broker.Addr()
+		}
+		for _, topicMetadata := range response.Topics {
+			if topicMetadata.Name != topic {
+				continue
+			}
+			if topicMetadata.Err != sarama.NoError {
+				return topicMetadata.Err
+			}
+
+			partitions := make([]int32, 0)
+			for _, partitionMetadata := range topicMetadata.Partitions {
+				partitions = append(partitions, partitionMetadata.ID)
+				if addr, exists := brokers[partitionMetadata.Leader]; exists && partitionMetadata.Err == sarama.NoError {
+					p.leaders[TopicAndPartition{topic, partitionMetadata.ID}] = addr
+				}
+			}
+			p.partitions[topic] = partitions
+			return nil
+		}
+
+		return sarama.IncompleteResponse
+	}
+
+	return err
+}
+
+func (p *KafkaProducer) invalidateMetadata(topic string) {
+	inLock(&p.lock, func() {
+		for _, partition := range p.partitions[topic] {
+			delete(p.leaders, TopicAndPartition{topic, partition})
+		}
+		delete(p.partitions, topic)
+	})
+}
+
+func (p *KafkaProducer) connect(addr string) (*sarama.Broker, error) {
+	brokerConfig := sarama.NewBrokerConfig()
+	brokerConfig.DialTimeout = p.config.SocketTimeout
+	brokerConfig.ReadTimeout = p.config.SocketTimeout
+	brokerConfig.WriteTimeout = p.config.SocketTimeout
+
+	broker := sarama.NewBroker(addr)
+	if err := broker.Open(brokerConfig); err != nil {
+		return nil, err
+	}
+	if connected, err := broker.Connected(); !connected {
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+func (p *KafkaProducer) disconnect(broker *sarama.Broker) {
+	inLock(&p.lock, func() {
+		if p.brokers[broker.Addr()] == broker {
+			delete(p.brokers, broker.Addr())
+		}
+	})
+	broker.Close()
+}
+
+// Waits for all queued messages to be delivered or failed, stops the batching routine and closes connections to all brokers.
+// Messages sent after Close fail immediately.
+func (p *KafkaProducer) Close() error {
+	alreadyClosed := false
+	inWriteLock(&p.closeLock, func() {
+		alreadyClosed = p.closed
+		p.closed = true
+	})
+	if alreadyClosed {
+		return nil
+	}
+
+	p.inFlight.Wait()
+	p.closing <- true
+	inLock(&p.lock, func() {
+		for addr, broker := range p.brokers {
+			broker.Close()
+			delete(p.brokers, addr)
+		}
+	})
+	return nil
+}
+
+// Encodes messages into a Kafka message set to be wrapped into a single compressed message.
+func encodeMessageSet(records []*producerRecord) []byte {
+	buffer := new(bytes.Buffer)
+	for i, record := range records {
+		message := new(bytes.Buffer)
+		binary.Write(message, binary.BigEndian, int8(0)) //magic byte
+		binary.Write(message, binary.BigEndian, int8(0)) //attributes
+		writeBytes(message, record.message.Key)
+		writeBytes(message, record.message.Value)
+
+		binary.Write(buffer, binary.BigEndian, int64(i))
+		binary.Write(buffer, binary.BigEndian, int32(message.Len()+4))
+		binary.Write(buffer, binary.BigEndian, crc32.ChecksumIEEE(message.Bytes()))
+		buffer.Write(message.Bytes())
+	}
+
+	return buffer.Bytes()
+}
+
+func writeBytes(buffer *bytes.Buffer, value []byte) {
+	if value == nil {
+		binary.Write(buffer, binary.BigEndian, int32(-1))
+		return
+	}
+	binary.Write(buffer, binary.BigEndian, int32(len(value)))
+	buffer.Write(value)
+}
@@ -0,0 +1,196 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Do not compress produced messages
+	NoCompression = "none"
+	// Compress produced messages with gzip
+	GzipCompression = "gzip"
+	// Compress produced messages with snappy
+	SnappyCompression = "snappy"
+)
+
+//ProducerConfig defines configuration options for KafkaProducer
+type ProducerConfig struct {
+	/* Client id is specified by the kafka producer client, used to distinguish different clients. */
+	Clientid string
+
+	/* List of brokers in host:port format used to fetch topic metadata. This does not have to be the full list of brokers in a cluster.
+	If empty, brokers are discovered through Coordinator. */
+	BrokerList []string
+
+	/* Coordinator used to discover brokers if BrokerList is empty. The Coordinator should be connected before the producer is used. */
+	Coordinator ConsumerCoordinator
+
+	/* The socket timeout for network requests. */
+	SocketTimeout time.Duration
+
+	/* Number of acknowledgements the leader should receive before responding to a produce request.
+	0 means the producer never waits for an acknowledgement, 1 means the leader should write the message to its local log, -1 means all in-sync replicas should acknowledge the message. */
+	RequiredAcks int16
+
+	/* The amount of time the broker will wait trying to meet the RequiredAcks requirement before sending back an error to the client. */
+	AckTimeout time.Duration
+
+	/* Function that chooses a partition for a message. Defaults to NewHashPartitioner(). */
+	Partitioner Partitioner
+
+	/* Encoder for ProducerMessage.KeyObject. If set, encoded bytes are sent as message key. */
+	KeyEncoder Encoder
+
+	/* Encoder for ProducerMessage.ValueObject. If set, encoded bytes are sent as message value. */
+	ValueEncoder Encoder
+
+	/* Compression codec for produced messages. Possible values: NoCompression, GzipCompression, SnappyCompression. */
+	CompressionCodec string
+
+	/* Number of messages for a single partition to accumulate before sending them to a broker. */
+	BatchSize int
+
+	/* Maximum time to accumulate messages. Accumulated messages are sent after this time even if BatchSize is not reached. */
+	BatchTimeout time.Duration
+
+	/* Max number of messages waiting to be batched. Asynchronous sends block once this number is reached. */
+	QueuedMaxMessages int
+
+	/* Retry sending a message up to this many times on failure. Topic metadata is refreshed before each retry, so messages are resent to the new leader once leader changes. */
+	SendMaxRetries int
+
+	/* Backoff time between retries to send a message. */
+	RetryBackoff time.Duration
+}
+
+//DefaultProducerConfig creates a ProducerConfig with sane defaults. Note that either BrokerList or Coordinator is still not set.
+func DefaultProducerConfig() *ProducerConfig {
+	config := &ProducerConfig{}
+	config.Clientid = "go-client"
+	config.SocketTimeout = 30 * time.Second
+	config.RequiredAcks = 1
+	config.AckTimeout = 10 * time.Second
+	config.Partitioner = NewHashPartitioner()
+	config.CompressionCodec = NoCompression
+	config.BatchSize = 100
+	config.BatchTimeout = 10 * time.Millisecond
+	config.QueuedMaxMessages = 1000
+	config.SendMaxRetries = 3
+	config.RetryBackoff = 100 * time.Millisecond
+
+	return config
+}
+
+func (c *ProducerConfig) String() string {
+	return fmt.Sprintf(`
+ClientId: %s
+BrokerList: %v
+SocketTimeout: %v
+RequiredAcks: %d
+AckTimeout: %v
+CompressionCodec: %s
+BatchSize: %d
+BatchTimeout: %v
+QueuedMaxMessages: %d
+SendMaxRetries: %d
+RetryBackoff: %v
+`, c.Clientid, c.BrokerList, c.SocketTimeout, c.RequiredAcks, c.AckTimeout, c.CompressionCodec,
+		c.BatchSize, c.BatchTimeout, c.QueuedMaxMessages, c.SendMaxRetries, c.RetryBackoff)
+}
+
+//Validates this ProducerConfig. Returns a corresponding error if the ProducerConfig is invalid and nil otherwise.
+func (c *ProducerConfig) Validate() error {
+	if c.Clientid == "" {
+		return errors.New("Clientid cannot be empty")
+	}
+
+	if len(c.BrokerList) == 0 && c.Coordinator == nil {
+		return errors.New("Please provide either a BrokerList or a Coordinator")
+	}
+
+	if c.RequiredAcks < -1 {
+		return errors.New("RequiredAcks cannot be less than -1")
+	}
+
+	if c.Partitioner == nil {
+		return errors.New("Please provide a Partitioner")
+	}
+
+	if c.CompressionCodec != NoCompression && c.CompressionCodec != GzipCompression && c.CompressionCodec != SnappyCompression {
+		return errors.New(fmt.Sprintf("CompressionCodec must be either \"%s\", \"%s\" or \"%s\"", NoCompression, GzipCompression, SnappyCompression))
+	}
+
+	if c.BatchSize <= 0 {
+		return errors.New("BatchSize should be at least 1")
+	}
+
+	if c.QueuedMaxMessages < 0 {
+		return errors.New("QueuedMaxMessages cannot be less than 0")
+	}
+
+	if c.SendMaxRetries < 0 {
+		return errors.New("SendMaxRetries cannot be less than 0")
+	}
+
+	return nil
+}
+
+func ProducerConfigFromFile(filename string) (*ProducerConfig, error) {
+	c, err := LoadConfiguration(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultProducerConfig()
+	setStringEntry(&config.Clientid, c["client.id"])
+	if c["metadata.broker.list"] != "" {
+		config.BrokerList = strings.Split(c["metadata.broker.list"], ",")
+	}
+	if err := setDurationEntry(&config.SocketTimeout, c["socket.timeout"]); err != nil {
+		return nil, err
+	}
+	requiredAcks := int(config.RequiredAcks)
+	if err := setIntEntry(&requiredAcks, c["request.required.acks"]); err != nil {
+		return nil, err
+	}
+	config.RequiredAcks = int16(requiredAcks)
+	if err := setDurationEntry(&config.AckTimeout, c["request.timeout"]); err != nil {
+		return nil, err
+	}
+	setStringEntry(&config.CompressionCodec, c["compression.codec"])
+	if err := setIntEntry(&config.BatchSize, c["batch.num.messages"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationEntry(&config.BatchTimeout, c["queue.buffering.max"]); err != nil {
+		return nil, err
+	}
+	if err := setIntEntry(&config.QueuedMaxMessages, c["queue.buffering.max.messages"]); err != nil {
+		return nil, err
+	}
+	if err := setIntEntry(&config.SendMaxRetries, c["message.send.max.retries"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationEntry(&config.RetryBackoff, c["retry.backoff"]); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
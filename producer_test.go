@@ -0,0 +1,222 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"hash/fnv"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+const (
+	produceKey  int16 = 0
+	metadataKey int16 = 3
+)
+
+func TestKafkaProducer(t *testing.T) {
+	broker := newMockKafkaBroker(t)
+	defer broker.Close()
+
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{fmt.Sprintf("%s:%d", broker.host, broker.port)}
+	config.SendMaxRetries = 1
+	config.RetryBackoff = 10 * time.Millisecond
+	producer, err := NewKafkaProducer(config)
+	assert(t, err, nil)
+	defer producer.Close()
+
+	topic := "fakeTopic"
+	key := []byte("key")
+	hash := fnv.New32a()
+	hash.Write(key)
+	partition := int32(hash.Sum32() % 2)
+
+	//metadata is fetched before the first message and messages with key go to the partition chosen by key hash
+	broker.Returns(metadataResponse(broker, topic, 2, sarama.NoError))
+	broker.Returns(produceResponse(topic, partition, sarama.NoError, 0))
+	err = producer.Send(&ProducerMessage{Topic: topic, Key: key, Value: []byte("value")})
+	assert(t, err, nil)
+	assert(t, requestKey(broker.NextRequest(time.Second)), metadataKey)
+	produceRequest := broker.NextRequest(time.Second)
+	assert(t, requestKey(produceRequest), produceKey)
+	codec, produced := producedMessages(produceRequest)
+	assert(t, codec, sarama.CompressionNone)
+	assert(t, len(produced), 1)
+	assert(t, produced[0].Partition, partition)
+	assert(t, produced[0].Key, key)
+	assert(t, produced[0].Value, []byte("value"))
+
+	//metadata is refreshed and message is resent if leader has moved
+	broker.Returns(produceResponse(topic, partition, sarama.NotLeaderForPartition, 0))
+	broker.Returns(metadataResponse(broker, topic, 2, sarama.NoError))
+	broker.Returns(produceResponse(topic, partition, sarama.NoError, 0))
+	err = producer.Send(&ProducerMessage{Topic: topic, Key: key, Value: []byte("value")})
+	assert(t, err, nil)
+	assert(t, requestKey(broker.NextRequest(time.Second)), produceKey)
+	assert(t, requestKey(broker.NextRequest(time.Second)), metadataKey)
+	assert(t, requestKey(broker.NextRequest(time.Second)), produceKey)
+
+	//error is returned once retries are exhausted
+	broker.Returns(metadataResponse(broker, "unknownTopic", 0, sarama.UnknownTopicOrPartition))
+	broker.Returns(metadataResponse(broker, "unknownTopic", 0, sarama.UnknownTopicOrPartition))
+	err = producer.Send(&ProducerMessage{Topic: "unknownTopic", Value: []byte("value")})
+	assert(t, err, sarama.UnknownTopicOrPartition)
+
+	_, err = NewKafkaProducer(DefaultProducerConfig())
+	assertNot(t, err, nil)
+}
+
+func TestKafkaProducerBatching(t *testing.T) {
+	broker := newMockKafkaBroker(t)
+	defer broker.Close()
+
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{fmt.Sprintf("%s:%d", broker.host, broker.port)}
+	config.BatchSize = 3
+	config.BatchTimeout = time.Minute
+	config.Partitioner = func(_ *ProducerMessage, numPartitions int32) int32 {
+		return numPartitions - 1
+	}
+	producer, err := NewKafkaProducer(config)
+	assert(t, err, nil)
+	defer producer.Close()
+
+	topic := "fakeTopic"
+	broker.Returns(metadataResponse(broker, topic, 2, sarama.NoError))
+	broker.Returns(produceResponse(topic, 1, sarama.NoError, 10))
+
+	//messages are sent with a single request once BatchSize is reached and get offsets in the order they were sent
+	delivered := make(chan *ProducerMessage, 3)
+	for i := 0; i < 3; i++ {
+		producer.SendAsync(&ProducerMessage{Topic: topic, Value: []byte(fmt.Sprintf("value-%d", i))}, func(message *ProducerMessage, err error) {
+			assert(t, err, nil)
+			delivered <- message
+		})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case message := <-delivered:
+			{
+				assert(t, message.Partition, int32(1))
+				assert(t, string(message.Value), fmt.Sprintf("value-%d", message.Offset-10))
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Failed to deliver batched messages within a second")
+		}
+	}
+
+	assert(t, requestKey(broker.NextRequest(time.Second)), metadataKey)
+	produceRequest := broker.NextRequest(time.Second)
+	assert(t, requestKey(produceRequest), produceKey)
+	_, produced := producedMessages(produceRequest)
+	assert(t, len(produced), 3)
+	for i, message := range produced {
+		assert(t, message.Partition, int32(1))
+		assert(t, message.Value, []byte(fmt.Sprintf("value-%d", i)))
+	}
+}
+
+func TestKafkaProducerCompression(t *testing.T) {
+	broker := newMockKafkaBroker(t)
+	defer broker.Close()
+
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{fmt.Sprintf("%s:%d", broker.host, broker.port)}
+	config.CompressionCodec = GzipCompression
+	config.BatchSize = 2
+	config.BatchTimeout = time.Minute
+	config.Partitioner = NewRoundRobinPartitioner()
+	producer, err := NewKafkaProducer(config)
+	assert(t, err, nil)
+	defer producer.Close()
+
+	topic := "fakeTopic"
+	broker.Returns(metadataResponse(broker, topic, 1, sarama.NoError))
+	broker.Returns(produceResponse(topic, 0, sarama.NoError, 0))
+	producer.SendAsync(&ProducerMessage{Topic: topic, Value: []byte("first")}, nil)
+	err = producer.Send(&ProducerMessage{Topic: topic, Value: []byte("second")})
+	assert(t, err, nil)
+
+	//batch is wrapped into a single gzipped message
+	assert(t, requestKey(broker.NextRequest(time.Second)), metadataKey)
+	codec, produced := producedMessages(broker.NextRequest(time.Second))
+	assert(t, codec, sarama.CompressionGZIP)
+	assert(t, len(produced), 1)
+	reader, err := gzip.NewReader(bytes.NewReader(produced[0].Value))
+	assert(t, err, nil)
+	messageSet, err := ioutil.ReadAll(reader)
+	assert(t, err, nil)
+	assert(t, messageSet, encodeMessageSet([]*producerRecord{
+		&producerRecord{message: &ProducerMessage{Value: []byte("first")}},
+		&producerRecord{message: &ProducerMessage{Value: []byte("second")}},
+	}))
+
+	config.CompressionCodec = "lz4"
+	_, err = NewKafkaProducer(config)
+	assertNot(t, err, nil)
+}
+
+func metadataResponse(broker *mockKafkaBroker, topic string, partitions int32, kafkaErr sarama.KError) []byte {
+	response := new(kafkaEncoder)
+	response.int32(1).int32(1).string(broker.host).int32(broker.port)
+	response.int32(1).int16(int16(kafkaErr)).string(topic).int32(partitions)
+	for partition := int32(0); partition < partitions; partition++ {
+		response.int16(int16(sarama.NoError)).int32(partition).int32(1)
+		response.int32(1).int32(1) //replicas
+		response.int32(1).int32(1) //isr
+	}
+	return response.Bytes()
+}
+
+func produceResponse(topic string, partition int32, kafkaErr sarama.KError, offset int64) []byte {
+	response := new(kafkaEncoder)
+	response.int32(1).string(topic)
+	response.int32(1).int32(partition).int16(int16(kafkaErr)).int64(offset)
+	return response.Bytes()
+}
+
+func producedMessages(request []byte) (sarama.CompressionCodec, []*ProducerMessage) {
+	decoder := newKafkaDecoder(request)
+	decoder.int16()  //api key
+	decoder.int16()  //api version
+	decoder.int32()  //correlation id
+	decoder.string() //client id
+	decoder.int16()  //required acks
+	decoder.int32()  //timeout
+	decoder.int32()  //topics
+	topic := decoder.string()
+	decoder.int32() //partitions
+	partition := decoder.int32()
+	messageSetSize := decoder.int32()
+
+	var codec sarama.CompressionCodec
+	messages := make([]*ProducerMessage, 0)
+	for read := int32(0); read < messageSetSize; {
+		offset := decoder.int64()
+		messageSize := decoder.int32()
+		decoder.int32() //crc
+		decoder.int8()  //magic byte
+		codec = sarama.CompressionCodec(decoder.int8() & 0x07)
+		messages = append(messages, &ProducerMessage{Topic: topic, Partition: partition, Offset: offset, Key: decoder.bytes(), Value: decoder.bytes()})
+		read += 12 + messageSize
+	}
+	return codec, messages
+}
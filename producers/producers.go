@@ -20,7 +20,6 @@ package main
 import (
 	kafkaClient "github.com/stealthly/go_kafka_client"
 	"time"
-	"github.com/stealthly/go-kafka/producer"
 	"fmt"
 	"strconv"
 	"os"
@@ -72,11 +71,16 @@ func main() {
 
 	kafkaClient.CreateMultiplePartitionsTopic(zkConnect, topic, numPartitions)
 
-	p := producer.NewKafkaProducer(topic, []string{brokerConnect})
+	producerConfig := kafkaClient.DefaultProducerConfig()
+	producerConfig.BrokerList = []string{brokerConnect}
+	p, err := kafkaClient.NewKafkaProducer(producerConfig)
+	if err != nil {
+		panic(err)
+	}
 	defer p.Close()
 	go func() {
 		for {
-			if err := p.SendStringSync(fmt.Sprintf("message %d!", numMessage)); err != nil {
+			if err := p.Send(&kafkaClient.ProducerMessage{Topic: topic, Value: []byte(fmt.Sprintf("message %d!", numMessage))}); err != nil {
 				panic(err)
 			}
 			numMessage++
@@ -0,0 +1,283 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bufio"
+	"fmt"
+	metrics "github.com/rcrowley/go-metrics"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Label names used for consumer metrics.
+	ConsumerIdLabel = "consumer_id"
+	GroupLabel      = "group"
+	TopicLabel      = "topic"
+	PartitionLabel  = "partition"
+
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Quantiles exported for timers and histograms.
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// MetricLabels describes how a metric registered in a metrics.Registry under a concatenated name should be exported,
+// e.g. FetchDuration-consumer1-manager is exported as fetch_duration_seconds{consumer_id="consumer1",group="group1"}.
+type MetricLabels struct {
+	// Metric name without any identifiers, e.g. FetchDuration.
+	Name string
+
+	// Labels that identify this metric, e.g. consumer id, group, topic and partition.
+	Labels map[string]string
+}
+
+var labeledMetrics = make(map[string]*MetricLabels)
+var labeledMetricsLock sync.RWMutex
+
+// Describes a metric registered under a given name with a given base name and labels so that exporters do not have to parse the registered name.
+// Returns the registered name so it can be used directly when registering the metric.
+func LabelMetric(registeredName string, name string, labels map[string]string) string {
+	inWriteLock(&labeledMetricsLock, func() {
+		labeledMetrics[registeredName] = &MetricLabels{name, labels}
+	})
+	return registeredName
+}
+
+// Removes labels of a metric registered under a given name. Should be called once the metric is unregistered.
+func UnlabelMetric(registeredName string) {
+	inWriteLock(&labeledMetricsLock, func() {
+		delete(labeledMetrics, registeredName)
+	})
+}
+
+// Returns labels of a metric registered under a given name. Metrics that were not labeled are exported under their registered name without labels.
+func metricLabels(registeredName string) *MetricLabels {
+	var labels *MetricLabels
+	inReadLock(&labeledMetricsLock, func() {
+		labels = labeledMetrics[registeredName]
+	})
+	if labels == nil {
+		labels = &MetricLabels{registeredName, nil}
+	}
+	return labels
+}
+
+// Returns a name to register a metric with, e.g. FetchDuration-<id> or CommitLag-<id>-<topic>-<partition> if topicPartition is not nil.
+func formatMetricName(name string, id string, topicPartition *TopicAndPartition) string {
+	if topicPartition == nil {
+		return fmt.Sprintf("%s-%s", name, id)
+	}
+	return fmt.Sprintf("%s-%s-%s-%d", name, id, topicPartition.Topic, topicPartition.Partition)
+}
+
+// Labels identifying metrics of a consumer with a given config. Topic and partition labels are added if topicPartition is not nil.
+func consumerMetricLabels(config *ConsumerConfig, topicPartition *TopicAndPartition) map[string]string {
+	labels := map[string]string{
+		ConsumerIdLabel: config.Consumerid,
+		GroupLabel:      config.Groupid,
+	}
+	if topicPartition != nil {
+		labels[TopicLabel] = topicPartition.Topic
+		labels[PartitionLabel] = fmt.Sprint(topicPartition.Partition)
+	}
+	return labels
+}
+
+// PrometheusExporter exposes all metrics of a metrics.Registry in Prometheus text exposition format.
+// It is an http.Handler so it can be mounted at /metrics of any HTTP server, e.g. http.Handle("/metrics", NewPrometheusExporter(metrics.DefaultRegistry, "kafka")).
+// Metric names are converted to snake case and labels described with LabelMetric are used instead of identifiers concatenated into metric names.
+// Counters and gauges are exported as gauges (go-metrics counters may be decremented), meters as counters and timers and histograms as summaries.
+// Timers are exported in seconds.
+type PrometheusExporter struct {
+	registry  metrics.Registry
+	namespace string
+}
+
+// Creates a new PrometheusExporter for a given registry. All exported metric names are prefixed with a given namespace unless it is empty.
+func NewPrometheusExporter(registry metrics.Registry, namespace string) *PrometheusExporter {
+	return &PrometheusExporter{registry, namespace}
+}
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	if err := e.Write(w); err != nil {
+		Warnf("prometheus", "Failed to write metrics: %s", err)
+	}
+}
+
+type prometheusSample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+type prometheusFamily struct {
+	name       string
+	metricType string
+	samples    []*prometheusSample
+}
+
+func (f *prometheusFamily) add(suffix string, labels map[string]string, extraLabel string, extraValue string, value float64) {
+	f.samples = append(f.samples, &prometheusSample{suffix, formatPrometheusLabels(labels, extraLabel, extraValue), value})
+}
+
+// Writes all metrics of the registry to a given writer in Prometheus text exposition format.
+func (e *PrometheusExporter) Write(writer io.Writer) error {
+	families := make(map[string]*prometheusFamily)
+	family := func(name string, suffix string, metricType string) *prometheusFamily {
+		name = prometheusName(e.namespace, name) + suffix
+		if existing, exists := families[name]; exists {
+			return existing
+		}
+		families[name] = &prometheusFamily{name: name, metricType: metricType}
+		return families[name]
+	}
+
+	e.registry.Each(func(registeredName string, metric interface{}) {
+		labeled := metricLabels(registeredName)
+		switch entry := metric.(type) {
+		case metrics.Counter:
+			family(labeled.Name, "", "gauge").add("", labeled.Labels, "", "", float64(entry.Count()))
+		case metrics.Gauge:
+			family(labeled.Name, "", "gauge").add("", labeled.Labels, "", "", float64(entry.Value()))
+		case metrics.GaugeFloat64:
+			family(labeled.Name, "", "gauge").add("", labeled.Labels, "", "", entry.Value())
+		case metrics.Meter:
+			family(labeled.Name, "_total", "counter").add("", labeled.Labels, "", "", float64(entry.Snapshot().Count()))
+		case metrics.Histogram:
+			snapshot := entry.Snapshot()
+			summary := family(labeled.Name, "", "summary")
+			addPrometheusSummary(summary, labeled.Labels, snapshot.Percentiles(prometheusQuantiles), float64(snapshot.Sum()), snapshot.Count(), 1)
+		case metrics.Timer:
+			snapshot := entry.Snapshot()
+			summary := family(labeled.Name, "_seconds", "summary")
+			addPrometheusSummary(summary, labeled.Labels, snapshot.Percentiles(prometheusQuantiles), float64(snapshot.Sum()), snapshot.Count(), 1e9)
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffered := bufio.NewWriter(writer)
+	for _, name := range names {
+		family := families[name]
+		sort.Sort(byPrometheusLabels(family.samples))
+		fmt.Fprintf(buffered, "# TYPE %s %s\n", family.name, family.metricType)
+		for _, sample := range family.samples {
+			fmt.Fprintf(buffered, "%s%s%s %s\n", family.name, sample.suffix, sample.labels, formatPrometheusValue(sample.value))
+		}
+	}
+	return buffered.Flush()
+}
+
+func addPrometheusSummary(summary *prometheusFamily, labels map[string]string, percentiles []float64, sum float64, count int64, unit float64) {
+	for i, quantile := range prometheusQuantiles {
+		summary.add("", labels, "quantile", strconv.FormatFloat(quantile, 'g', -1, 64), percentiles[i]/unit)
+	}
+	summary.add("_sum", labels, "", "", sum/unit)
+	summary.add("_count", labels, "", "", float64(count))
+}
+
+type byPrometheusLabels []*prometheusSample
+
+func (a byPrometheusLabels) Len() int      { return len(a) }
+func (a byPrometheusLabels) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPrometheusLabels) Less(i, j int) bool {
+	if a[i].labels != a[j].labels {
+		return a[i].labels < a[j].labels
+	}
+	return a[i].suffix < a[j].suffix
+}
+
+// Converts a go-metrics name like WMsBatchDuration to a valid Prometheus name like wms_batch_duration.
+func prometheusName(namespace string, name string) string {
+	converted := make([]rune, 0, len(name)+len(namespace)+1)
+	if namespace != "" {
+		converted = append(converted, []rune(prometheusName("", namespace)+"_")...)
+	}
+
+	var previous rune
+	for _, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if (previous >= 'a' && previous <= 'z') || (previous >= '0' && previous <= '9') {
+				converted = append(converted, '_')
+			}
+			converted = append(converted, r-'A'+'a')
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == ':':
+			converted = append(converted, r)
+		default:
+			if len(converted) > 0 && converted[len(converted)-1] != '_' {
+				converted = append(converted, '_')
+			}
+		}
+		previous = r
+	}
+
+	if len(converted) > 0 && converted[0] >= '0' && converted[0] <= '9' {
+		converted = append([]rune{'_'}, converted...)
+	}
+	return string(converted)
+}
+
+func formatPrometheusLabels(labels map[string]string, extraLabel string, extraValue string) string {
+	if len(labels) == 0 && extraLabel == "" {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", prometheusName("", key), escapePrometheusLabelValue(labels[key])))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraLabel, escapePrometheusLabelValue(extraValue)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapePrometheusLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func formatPrometheusValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,114 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	metrics "github.com/rcrowley/go-metrics"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Groupid = "prometheus-group"
+	config.Consumerid = "prometheus-consumer"
+	topicPartition := TopicAndPartition{"fake\"Topic", 2}
+	registry := metrics.NewRegistry()
+
+	counter := metrics.NewRegisteredCounter(LabelMetric("WMsPendingTasks-prometheus-consumer", "WMsPendingTasks", consumerMetricLabels(config, nil)), registry)
+	counter.Inc(3)
+	gauge := metrics.NewRegisteredGauge(LabelMetric("CommitLag-prometheus-consumer-fake\"Topic-2", "CommitLag", consumerMetricLabels(config, &topicPartition)), registry)
+	gauge.Update(42)
+	timer := metrics.NewRegisteredTimer(LabelMetric("FetchDuration-prometheus-consumer-manager", "FetchDuration", consumerMetricLabels(config, nil)), registry)
+	timer.Update(2 * time.Second)
+	meter := metrics.NewRegisteredMeter("main-ConsumeRate", registry)
+	meter.Mark(5)
+	defer UnlabelMetric("WMsPendingTasks-prometheus-consumer")
+	defer UnlabelMetric("CommitLag-prometheus-consumer-fake\"Topic-2")
+	defer UnlabelMetric("FetchDuration-prometheus-consumer-manager")
+
+	var buffer bytes.Buffer
+	assert(t, NewPrometheusExporter(registry, "kafka").Write(&buffer), nil)
+	expected := []string{
+		`# TYPE kafka_commit_lag gauge`,
+		`kafka_commit_lag{consumer_id="prometheus-consumer",group="prometheus-group",partition="2",topic="fake\"Topic"} 42`,
+		`# TYPE kafka_fetch_duration_seconds summary`,
+		`kafka_fetch_duration_seconds{consumer_id="prometheus-consumer",group="prometheus-group",quantile="0.5"} 2`,
+		`kafka_fetch_duration_seconds{consumer_id="prometheus-consumer",group="prometheus-group",quantile="0.75"} 2`,
+		`kafka_fetch_duration_seconds{consumer_id="prometheus-consumer",group="prometheus-group",quantile="0.95"} 2`,
+		`kafka_fetch_duration_seconds{consumer_id="prometheus-consumer",group="prometheus-group",quantile="0.99"} 2`,
+		`kafka_fetch_duration_seconds{consumer_id="prometheus-consumer",group="prometheus-group",quantile="0.999"} 2`,
+		`kafka_fetch_duration_seconds_count{consumer_id="prometheus-consumer",group="prometheus-group"} 1`,
+		`kafka_fetch_duration_seconds_sum{consumer_id="prometheus-consumer",group="prometheus-group"} 2`,
+		`# TYPE kafka_main_consume_rate_total counter`,
+		`kafka_main_consume_rate_total 5`,
+		`# TYPE kafka_wms_pending_tasks gauge`,
+		`kafka_wms_pending_tasks{consumer_id="prometheus-consumer",group="prometheus-group"} 3`,
+		``,
+	}
+	assert(t, strings.Split(buffer.String(), "\n"), expected)
+
+	//unlabeled metrics keep their registered name
+	UnlabelMetric("CommitLag-prometheus-consumer-fake\"Topic-2")
+	recorder := httptest.NewRecorder()
+	NewPrometheusExporter(registry, "").ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert(t, recorder.Header().Get("Content-Type"), prometheusContentType)
+	assert(t, strings.Contains(recorder.Body.String(), "\ncommit_lag_prometheus_consumer_fake_topic_2 42\n"), true)
+
+	assert(t, prometheusName("", "NumFetchRoutines"), "num_fetch_routines")
+	assert(t, prometheusName("", "BatchesSentToWM"), "batches_sent_to_wm")
+	assert(t, prometheusName("", "1-ProduceRate"), "_1_produce_rate")
+}
+
+func TestConsumerMetricsRegistry(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Consumerid = "metrics-consumer"
+	config.MetricsRegistry = metrics.NewRegistry()
+	otherConfig := DefaultConsumerConfig()
+	otherConfig.Consumerid = "other-consumer"
+	otherConfig.MetricsRegistry = config.MetricsRegistry
+	consumer := &Consumer{config: config, metricNames: make(map[string]bool), fetcher: &consumerFetcherManager{highWatermarks: make(map[TopicAndPartition]int64)}}
+	other := &Consumer{config: otherConfig, metricNames: make(map[string]bool)}
+	topicPartition := TopicAndPartition{"fakeTopic", 0}
+
+	metrics.NewRegisteredCounter(consumer.metricName("BatchesSentToWM", nil), config.MetricsRegistry).Inc(1)
+	metrics.NewRegisteredCounter(other.metricName("BatchesSentToWM", nil), config.MetricsRegistry).Inc(2)
+	partitionMetrics := consumer.newPartitionMetrics(topicPartition)
+	partitionMetrics.Messages.Mark(3)
+	consumer.registerLagGauges(topicPartition, &WorkerManager{largestOffset: InvalidOffset, lastCommittedOffset: InvalidOffset})
+
+	//state snapshot contains only metrics of this consumer even though the registry is shared
+	snapshot := consumer.StateSnapshot()
+	assert(t, len(snapshot.Metrics), 1+len(partitionMetricNames))
+	assert(t, snapshot.Metrics["BatchesSentToWM-metrics-consumer"]["count"], float64(1))
+	assert(t, snapshot.Metrics["MessagesProcessed-metrics-consumer-fakeTopic-0"]["count"], float64(3))
+	assert(t, snapshot.Metrics["CommitLag-metrics-consumer-fakeTopic-0"]["value"], float64(InvalidOffset))
+
+	//partition metrics are recreated from scratch when the partition is assigned again
+	assert(t, consumer.newPartitionMetrics(topicPartition).Messages.Count(), int64(0))
+
+	consumer.unregisterPartitionMetrics(topicPartition)
+	assert(t, len(consumer.StateSnapshot().Metrics), 1)
+
+	consumer.unregisterMetrics()
+	assert(t, len(consumer.StateSnapshot().Metrics), 0)
+	assert(t, metricLabels("BatchesSentToWM-metrics-consumer").Labels, map[string]string(nil))
+	assert(t, config.MetricsRegistry.Get("BatchesSentToWM-other-consumer").(metrics.Counter).Count(), int64(2))
+	other.unregisterMetrics()
+}
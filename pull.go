@@ -0,0 +1,104 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Returns a channel messages are delivered to if ConsumerConfig.PullMode is enabled, or nil otherwise.
+// Each message received from this channel should be acknowledged with Ack once it is processed or with Nack if processing failed.
+// The channel is closed once the Consumer is closed.
+func (c *Consumer) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Tells the Consumer that a message received from Messages() is processed, so its offset can be committed.
+// Returns an error if the message is not awaiting acknowledgement, e.g. because it was not acknowledged within ConsumerConfig.WorkerTaskTimeout and is going to be redelivered.
+func (c *Consumer) Ack(message *Message) error {
+	id := TaskId{TopicAndPartition{message.Topic, message.Partition}, message.Offset}
+	return c.acknowledge(id, NewSuccessfulResult(id))
+}
+
+// Tells the Consumer that a message received from Messages() failed to process.
+// The message is then handled the same way as a message a Strategy failed to process: it is redelivered after ConsumerConfig.WorkerBackoff
+// until ConsumerConfig.MaxWorkerRetries is reached and WorkerFailedAttemptCallback decides what to do next.
+// Returns an error if the message is not awaiting acknowledgement.
+func (c *Consumer) Nack(message *Message) error {
+	id := TaskId{TopicAndPartition{message.Topic, message.Partition}, message.Offset}
+	return c.acknowledge(id, NewProcessingFailedResult(id))
+}
+
+func (c *Consumer) acknowledge(id TaskId, result WorkerResult) error {
+	var acks chan WorkerResult
+	inLock(&c.pendingAcksLock, func() {
+		acks = c.pendingAcks[id]
+		delete(c.pendingAcks, id)
+	})
+	if acks == nil {
+		return fmt.Errorf("Message %s is not awaiting acknowledgement", id)
+	}
+
+	acks <- result
+	return nil
+}
+
+// Strategy used in pull mode. Delivers a message to Messages() and waits until it is acknowledged.
+// Messages that are not delivered and acknowledged within the worker's TaskTimeout are considered timed out.
+func (c *Consumer) pullStrategy(worker *Worker, message *Message, id TaskId) WorkerResult {
+	acks := make(chan WorkerResult, 1)
+	inLock(&c.pendingAcksLock, func() {
+		c.pendingAcks[id] = acks
+	})
+	defer inLock(&c.pendingAcksLock, func() {
+		if c.pendingAcks[id] == acks {
+			delete(c.pendingAcks, id)
+		}
+	})
+
+	timeout := time.After(worker.TaskTimeout)
+	delivered := false
+	inReadLock(&c.messagesLock, func() {
+		select {
+		case c.messages <- message:
+			delivered = true
+		case <-timeout:
+		case <-c.messagesStop:
+		}
+	})
+	if !delivered {
+		return &TimedOutResult{id}
+	}
+
+	select {
+	case result := <-acks:
+		return result
+	case <-timeout:
+		Warnf(c, "Message %s was not acknowledged within %s", id, worker.TaskTimeout)
+		return &TimedOutResult{id}
+	case <-c.messagesStop:
+		return &TimedOutResult{id}
+	}
+}
+
+// Closes the channel returned by Messages(). Should be called only after all WorkerManagers are stopped.
+func (c *Consumer) closeMessages() {
+	close(c.messagesStop)
+	inWriteLock(&c.messagesLock, func() {
+		close(c.messages)
+	})
+}
@@ -0,0 +1,124 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	metrics "github.com/rcrowley/go-metrics"
+	"testing"
+	"time"
+)
+
+func TestPullMode(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.PullMode = true
+	config.NumWorkers = 2
+	config.MaxWorkerRetries = 3
+	config.WorkerBackoff = 10 * time.Millisecond
+	config.WorkerTaskTimeout = 1 * time.Second
+	config.WorkerThresholdTimeWindow = 1 * time.Minute
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision { return DoNotCommitOffsetAndStop }
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision { return DoNotCommitOffsetAndContinue }
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", 0}
+
+	consumer := &Consumer{
+		config:       config,
+		messages:     make(chan *Message),
+		messagesStop: make(chan bool),
+		pendingAcks:  make(map[TaskId]chan WorkerResult),
+	}
+	assert(t, config.Validate(), nil)
+	config.Strategy = consumer.pullStrategy
+
+	partitionMetrics := NewPartitionMetrics()
+	manager := NewWorkerManager("test-WM-pull", config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), partitionMetrics)
+	go manager.Start()
+
+	batch := make([]*Message, 0)
+	for i := 0; i < 4; i++ {
+		batch = append(batch, &Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i)})
+	}
+	go func() { manager.inputChannel <- batch }()
+
+	nacked := false
+	for acked := 0; acked < 4; {
+		message := receiveMessage(t, consumer)
+		if message.Offset == 2 && !nacked {
+			assert(t, consumer.Nack(message), nil)
+			nacked = true
+			continue
+		}
+		assert(t, consumer.Ack(message), nil)
+		acked++
+	}
+	assert(t, nacked, true)
+	assertNot(t, consumer.Ack(batch[2]), nil)
+
+	//messages that are not acknowledged in time are redelivered
+	go func() { manager.inputChannel <- []*Message{&Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 4}} }()
+	message := receiveMessage(t, consumer)
+	assert(t, message.Offset, int64(4))
+	redelivered := receiveMessage(t, consumer)
+	assert(t, redelivered.Offset, int64(4))
+	assert(t, consumer.Ack(message), nil)
+
+	<-manager.Stop()
+	offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(4))
+	assert(t, partitionMetrics.Messages.Count(), int64(5))
+	assert(t, partitionMetrics.Failures.Count(), int64(2))
+
+	consumer.closeMessages()
+	_, open := <-consumer.Messages()
+	assert(t, open, false)
+
+	config.BatchStrategy = func(_ *Worker, _ []*Message, _ []TaskId) []WorkerResult { return nil }
+	assertNot(t, config.Validate(), nil)
+
+	//consumers created from the same config deliver messages to their own Messages() channels
+	config.BatchStrategy = nil
+	config.Strategy = nil
+	config.OffsetStore = offsetStore
+	first := NewConsumer(config)
+	second := NewConsumer(config)
+	assert(t, config.Strategy == nil, true)
+	firstManager := NewWorkerManager("test-WM-pull-first", first.config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+	go firstManager.Start()
+	go func() { firstManager.inputChannel <- []*Message{&Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 5}} }()
+	message = receiveMessage(t, first)
+	assert(t, message.Offset, int64(5))
+	select {
+	case message := <-second.Messages():
+		t.Errorf("Message %d of the first consumer is delivered to the second one", message.Offset)
+	default:
+	}
+	assert(t, first.Ack(message), nil)
+	<-firstManager.Stop()
+}
+
+func receiveMessage(t *testing.T, consumer *Consumer) *Message {
+	select {
+	case message := <-consumer.Messages():
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("Failed to receive a message within 5 seconds")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DelayedRetry is an envelope for a message that failed to be processed and was sent to a retry topic to be processed again after a delay.
+// It is encoded as JSON. Messages from retry topics are unwrapped before they are passed to Strategy, so Strategy always gets the original message.
+type DelayedRetry struct {
+	// Topic the failed message originally came from.
+	Topic string
+
+	// Partition the failed message originally came from.
+	Partition int32
+
+	// Original offset of the failed message.
+	Offset int64
+
+	// Partition key of the failed message.
+	Key []byte
+
+	// Value of the failed message.
+	Value []byte
+
+	// Why the last processing attempt failed.
+	Reason string
+
+	// Number of retry topics this message has been sent to, starting from 1.
+	Attempt int
+
+	// Time after which the message should be processed again.
+	RetryAt time.Time
+}
+
+func (dr *DelayedRetry) String() string {
+	return fmt.Sprintf("{Topic: %s, Partition: %d, Offset: %d, Attempt: %d, RetryAt: %s}", dr.Topic, dr.Partition, dr.Offset, dr.Attempt, dr.RetryAt)
+}
+
+// Returns a message this DelayedRetry was created for.
+func (dr *DelayedRetry) Message() *Message {
+	return &Message{
+		Key:       dr.Key,
+		Value:     dr.Value,
+		Topic:     dr.Topic,
+		Partition: dr.Partition,
+		Offset:    dr.Offset,
+	}
+}
+
+// Returns a name of the retry topic for a given topic and delay, e.g. "events.retry.1m" for topic "events" and delay of 1 minute.
+func RetryTopic(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topic, formatRetryDelay(delay))
+}
+
+// Checks whether a given topic is a retry topic for one of given delays.
+// Returns the original topic and the index of the delay in delays if so, and false otherwise.
+func parseRetryTopic(topic string, delays []time.Duration) (string, int, bool) {
+	for i, delay := range delays {
+		suffix := fmt.Sprintf(".retry.%s", formatRetryDelay(delay))
+		if strings.HasSuffix(topic, suffix) {
+			return strings.TrimSuffix(topic, suffix), i, true
+		}
+	}
+
+	return "", -1, false
+}
+
+func formatRetryDelay(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return fmt.Sprintf("%dms", delay/time.Millisecond)
+	}
+}
+
+// FailedAttemptCallback that sends every message that failed to be processed after MaxWorkerRetries to the next retry topic.
+func RetryTopicFailedAttemptCallback(_ *Task, _ WorkerResult) FailedDecision {
+	return SendToRetryTopicAndContinue
+}
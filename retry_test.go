@@ -0,0 +1,40 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryTopic(t *testing.T) {
+	assert(t, RetryTopic("events", 1*time.Minute), "events.retry.1m")
+	assert(t, RetryTopic("events", 10*time.Minute), "events.retry.10m")
+	assert(t, RetryTopic("events", 2*time.Hour), "events.retry.2h")
+	assert(t, RetryTopic("events", 30*time.Second), "events.retry.30s")
+	assert(t, RetryTopic("events", 1500*time.Millisecond), "events.retry.1500ms")
+
+	delays := []time.Duration{1 * time.Minute, 10 * time.Minute}
+	topic, tier, isRetryTopic := parseRetryTopic("events.retry.10m", delays)
+	assert(t, isRetryTopic, true)
+	assert(t, topic, "events")
+	assert(t, tier, 1)
+
+	_, _, isRetryTopic = parseRetryTopic("events.retry.5m", delays)
+	assert(t, isRetryTopic, false)
+	_, _, isRetryTopic = parseRetryTopic("events", delays)
+	assert(t, isRetryTopic, false)
+}
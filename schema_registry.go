@@ -0,0 +1,284 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Magic byte that starts every message framed with a schema registry schema id.
+	schemaRegistryMagicByte byte = 0
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// SchemaRegistry is an interface that is used to resolve Avro schemas by their ids and register new schemas.
+type SchemaRegistry interface {
+	/* Returns a schema registered with a given id. */
+	GetSchema(id int32) (*AvroSchema, error)
+
+	/* Registers a given schema under a given subject and returns its id. Registering an already registered schema returns its existing id. */
+	Register(subject string, schema string) (int32, error)
+}
+
+// CachedSchemaRegistryClient is a SchemaRegistry implementation that talks to a Confluent-compatible schema registry over HTTP.
+// Schemas and ids are cached forever once resolved, as registered schemas are immutable. Each schema id is fetched only once:
+// goroutines looking up an id that is being fetched wait for that fetch and share its result.
+// A single client is safe to use from all WorkerManagers and producers. The schema registry is called without holding the cache lock, so a slow registry does not delay cached lookups.
+type CachedSchemaRegistryClient struct {
+	url            string
+	httpClient     *http.Client
+	schemas        map[int32]*AvroSchema
+	pendingSchemas map[int32]*schemaFetch
+	ids            map[string]int32
+	lock           sync.Mutex
+}
+
+// schemaFetch is a schema registry lookup of a schema id that is in progress. done is closed once schema or err is set.
+type schemaFetch struct {
+	done   chan struct{}
+	schema *AvroSchema
+	err    error
+}
+
+// Creates a new CachedSchemaRegistryClient for a schema registry at a given url, e.g. http://localhost:8081.
+func NewCachedSchemaRegistryClient(url string) *CachedSchemaRegistryClient {
+	return &CachedSchemaRegistryClient{
+		url:            strings.TrimRight(url, "/"),
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		schemas:        make(map[int32]*AvroSchema),
+		pendingSchemas: make(map[int32]*schemaFetch),
+		ids:            make(map[string]int32),
+	}
+}
+
+func (c *CachedSchemaRegistryClient) String() string {
+	return fmt.Sprintf("schema-registry-%s", c.url)
+}
+
+type schemaRegistryRequest struct {
+	Schema string `json:"schema"`
+}
+
+type schemaRegistryResponse struct {
+	Id        int32  `json:"id"`
+	Schema    string `json:"schema"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Returns a schema registered with a given id, fetching it from the schema registry if it is not cached yet.
+// If the id is already being fetched by another goroutine, waits for that fetch instead of calling the schema registry again.
+func (c *CachedSchemaRegistryClient) GetSchema(id int32) (*AvroSchema, error) {
+	var schema *AvroSchema
+	var fetch *schemaFetch
+	fetching := false
+	inLock(&c.lock, func() {
+		if schema = c.schemas[id]; schema != nil {
+			return
+		}
+		if fetch, fetching = c.pendingSchemas[id]; !fetching {
+			fetch = &schemaFetch{done: make(chan struct{})}
+			c.pendingSchemas[id] = fetch
+		}
+	})
+	if schema != nil {
+		return schema, nil
+	}
+	if fetching {
+		<-fetch.done
+		return fetch.schema, fetch.err
+	}
+
+	fetch.schema, fetch.err = c.fetchSchema(id)
+	inLock(&c.lock, func() {
+		if cached, exists := c.schemas[id]; exists && fetch.err == nil {
+			fetch.schema = cached
+		} else if fetch.err == nil {
+			c.schemas[id] = fetch.schema
+		}
+		delete(c.pendingSchemas, id)
+	})
+	close(fetch.done)
+
+	return fetch.schema, fetch.err
+}
+
+func (c *CachedSchemaRegistryClient) fetchSchema(id int32) (*AvroSchema, error) {
+	response, err := c.request("GET", fmt.Sprintf("/schemas/ids/%d", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := ParseAvroSchema(response.Schema)
+	if err != nil {
+		return nil, err
+	}
+	Debugf(c, "Fetched schema with id %d", id)
+	return schema, nil
+}
+
+// Registers a given schema under a given subject unless it was already registered with this client, and returns its id.
+func (c *CachedSchemaRegistryClient) Register(subject string, schema string) (int32, error) {
+	key := subject + "\x00" + schema
+	var id int32
+	registered := false
+	inLock(&c.lock, func() {
+		id, registered = c.ids[key]
+	})
+	if registered {
+		return id, nil
+	}
+
+	avroSchema, err := ParseAvroSchema(schema)
+	if err != nil {
+		return 0, err
+	}
+	response, err := c.request("POST", fmt.Sprintf("/subjects/%s/versions", subject), &schemaRegistryRequest{schema})
+	if err != nil {
+		return 0, err
+	}
+	Infof(c, "Registered schema for subject %s with id %d", subject, response.Id)
+	inLock(&c.lock, func() {
+		c.ids[key] = response.Id
+		if _, exists := c.schemas[response.Id]; !exists {
+			c.schemas[response.Id] = avroSchema
+		}
+	})
+
+	return response.Id, nil
+}
+
+func (c *CachedSchemaRegistryClient) request(method string, path string, body interface{}) (*schemaRegistryResponse, error) {
+	var requestBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&requestBody).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := http.NewRequest(method, c.url+path, &requestBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	registryResponse := &schemaRegistryResponse{}
+	if response.StatusCode != http.StatusOK {
+		//error pages of proxies in front of the registry (e.g. 502) are not JSON, so the status is reported even if the body cannot be decoded
+		if err := json.NewDecoder(response.Body).Decode(registryResponse); err != nil {
+			return nil, fmt.Errorf("Schema registry returned %d for %s %s", response.StatusCode, method, path)
+		}
+		return nil, fmt.Errorf("Schema registry returned %d for %s %s: %s (error code %d)", response.StatusCode, method, path, registryResponse.Message, registryResponse.ErrorCode)
+	}
+	if err := json.NewDecoder(response.Body).Decode(registryResponse); err != nil {
+		return nil, fmt.Errorf("Invalid schema registry response for %s %s: %s", method, path, err)
+	}
+
+	return registryResponse, nil
+}
+
+// KafkaAvroDecoder is a Decoder that decodes Avro messages framed with a schema registry schema id (magic byte followed by 4-byte schema id).
+// Writer schemas are resolved with a SchemaRegistry, so pass the same SchemaRegistry to all decoders to resolve each schema only once.
+type KafkaAvroDecoder struct {
+	registry SchemaRegistry
+	newValue func() interface{}
+}
+
+// Creates a new KafkaAvroDecoder that resolves schemas with a given SchemaRegistry.
+// If newValue is not nil it should return a pointer to a new value to decode messages into, e.g. func() interface{} { return &User{} }, see AvroSchema.DecodeInto.
+// Otherwise messages are decoded into generic values, see AvroSchema.Decode.
+func NewKafkaAvroDecoder(registry SchemaRegistry, newValue func() interface{}) *KafkaAvroDecoder {
+	return &KafkaAvroDecoder{registry, newValue}
+}
+
+// Decodes given framed Avro bytes.
+func (d *KafkaAvroDecoder) Decode(bytes []byte) (interface{}, error) {
+	if len(bytes) < 5 {
+		return nil, errors.New("Message is too short to contain a schema id")
+	}
+	if bytes[0] != schemaRegistryMagicByte {
+		return nil, fmt.Errorf("Unknown magic byte %d", bytes[0])
+	}
+
+	schema, err := d.registry.GetSchema(int32(binary.BigEndian.Uint32(bytes[1:5])))
+	if err != nil {
+		return nil, err
+	}
+
+	if d.newValue == nil {
+		return schema.Decode(bytes[5:])
+	}
+	value := d.newValue()
+	if err := schema.DecodeInto(bytes[5:], value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// KafkaAvroEncoder is an Encoder that encodes values with a given Avro schema and frames them with the schema id (magic byte followed by 4-byte schema id).
+// The schema is registered in a SchemaRegistry under a given subject on first use.
+type KafkaAvroEncoder struct {
+	registry SchemaRegistry
+	subject  string
+	schema   string
+	parsed   *AvroSchema
+}
+
+// Creates a new KafkaAvroEncoder for a given schema that is registered under a given subject, e.g. "events-value".
+// Returns an error if the schema cannot be parsed.
+func NewKafkaAvroEncoder(registry SchemaRegistry, subject string, schema string) (*KafkaAvroEncoder, error) {
+	parsed, err := ParseAvroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaAvroEncoder{registry, subject, schema, parsed}, nil
+}
+
+// Encodes a given value, see AvroSchema.Encode for supported values.
+func (e *KafkaAvroEncoder) Encode(value interface{}) ([]byte, error) {
+	id, err := e.registry.Register(e.subject, e.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := e.parsed.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	framed := make([]byte, 5, 5+len(data))
+	framed[0] = schemaRegistryMagicByte
+	binary.BigEndian.PutUint32(framed[1:5], uint32(id))
+	return append(framed, data...), nil
+}
@@ -0,0 +1,185 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+ contributor license agreements.  See the NOTICE file distributed with
+ this work for additional information regarding copyright ownership.
+ The ASF licenses this file to You under the Apache License, Version 2.0
+ (the "License"); you may not use this file except in compliance with
+ the License.  You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	Name     string
+	Age      int
+	Nickname *string
+	Color    string
+	Tags     []string `avro:"tags"`
+	Friend   *testUser
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	registry := newMockSchemaRegistry()
+	defer registry.Close()
+
+	encoder, err := NewKafkaAvroEncoder(NewCachedSchemaRegistryClient(registry.server.URL), "users-value", testAvroSchema)
+	assert(t, err, nil)
+
+	nickname := "johnny"
+	user := &testUser{Name: "john", Age: 42, Nickname: &nickname, Color: "GREEN", Tags: []string{"a", "b"},
+		Friend: &testUser{Name: "jane", Age: 30, Color: "RED", Tags: []string{}}}
+	first, err := encoder.Encode(user)
+	assert(t, err, nil)
+	second, err := encoder.Encode(user)
+	assert(t, err, nil)
+	assert(t, first, second)
+	//schema is registered only once
+	assert(t, registry.Requests(), 1)
+	assert(t, first[:5], []byte{0, 0, 0, 0, 1})
+
+	//schema ids are resolved once and shared by all decoders using the same client
+	client := NewCachedSchemaRegistryClient(registry.server.URL)
+	genericDecoder := NewKafkaAvroDecoder(client, nil)
+	structDecoder := NewKafkaAvroDecoder(client, func() interface{} { return &testUser{} })
+
+	value, err := genericDecoder.Decode(first)
+	assert(t, err, nil)
+	assert(t, value.(map[string]interface{})["name"], "john")
+	assert(t, value.(map[string]interface{})["friend"].(map[string]interface{})["age"], int32(30))
+
+	value, err = structDecoder.Decode(second)
+	assert(t, err, nil)
+	assert(t, value, user)
+	assert(t, registry.Requests(), 2)
+
+	_, err = genericDecoder.Decode([]byte{0, 0, 0, 0, 2, 1})
+	assertNot(t, err, nil)
+	_, err = genericDecoder.Decode([]byte{1, 0, 0, 0, 1, 1})
+	assertNot(t, err, nil)
+
+	_, err = encoder.Encode(map[string]interface{}{"name": "john"})
+	assertNot(t, err, nil)
+
+	//registry errors keep their HTTP status
+	_, err = client.GetSchema(3)
+	assert(t, err.Error(), "Schema registry returned 404 for GET /schemas/ids/3: Schema not found (error code 40403)")
+	badGateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}))
+	defer badGateway.Close()
+	_, err = NewCachedSchemaRegistryClient(badGateway.URL).GetSchema(1)
+	assert(t, err.Error(), "Schema registry returned 502 for GET /schemas/ids/1")
+}
+
+func TestSchemaRegistryCachedLookupsDoNotWait(t *testing.T) {
+	requested := make(chan bool, 1)
+	release := make(chan bool)
+	slowRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		requested <- true
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer slowRegistry.Close()
+
+	client := NewCachedSchemaRegistryClient(slowRegistry.URL)
+	cached, err := ParseAvroSchema(testAvroSchema)
+	assert(t, err, nil)
+	client.schemas[1] = cached
+
+	fetched := make(chan error)
+	go func() {
+		_, err := client.GetSchema(2)
+		fetched <- err
+	}()
+	<-requested
+
+	//a cached schema is returned while the registry is slow to respond to another lookup
+	lookup := make(chan *AvroSchema)
+	go func() {
+		schema, _ := client.GetSchema(1)
+		lookup <- schema
+	}()
+	select {
+	case schema := <-lookup:
+		assert(t, schema, cached)
+	case <-time.After(5 * time.Second):
+		t.Error("Cached schema lookup waited for another lookup")
+	}
+
+	close(release)
+	assertNot(t, <-fetched, nil)
+}
+
+func TestSchemaRegistryConcurrentLookups(t *testing.T) {
+	registry := newMockSchemaRegistry()
+	defer registry.Close()
+	id, err := NewCachedSchemaRegistryClient(registry.server.URL).Register("users-value", testAvroSchema)
+	assert(t, err, nil)
+
+	//lookups of an id that is being fetched wait for that fetch instead of calling the registry again
+	client := NewCachedSchemaRegistryClient(registry.server.URL)
+	registry.lock.Lock()
+	schemas := make(chan *AvroSchema)
+	for i := 0; i < 10; i++ {
+		go func() {
+			schema, err := client.GetSchema(id)
+			assert(t, err, nil)
+			schemas <- schema
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	registry.lock.Unlock()
+	first := <-schemas
+	assertNot(t, first, (*AvroSchema)(nil))
+	for i := 1; i < 10; i++ {
+		assert(t, <-schemas == first, true)
+	}
+	assert(t, registry.Requests(), 2)
+
+	//a failed fetch is not cached, so the next lookup calls the registry again
+	_, err = client.GetSchema(id + 1)
+	assertNot(t, err, nil)
+	assert(t, registry.Requests(), 3)
+	_, err = client.GetSchema(id + 1)
+	assertNot(t, err, nil)
+	assert(t, registry.Requests(), 4)
+}
+
+func TestKafkaProducerEncoders(t *testing.T) {
+	registry := newMockSchemaRegistry()
+	defer registry.Close()
+
+	encoder, err := NewKafkaAvroEncoder(NewCachedSchemaRegistryClient(registry.server.URL), "users-value", testAvroSchema)
+	assert(t, err, nil)
+
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{"localhost:0"}
+	config.ValueEncoder = encoder
+	producer, err := NewKafkaProducer(config)
+	assert(t, err, nil)
+	defer producer.Close()
+
+	//messages that cannot be encoded fail without being sent
+	err = producer.Send(&ProducerMessage{Topic: "users", ValueObject: &testUser{Name: "john", Color: "BLUE"}})
+	assertNot(t, err, nil)
+
+	message := &ProducerMessage{Topic: "users", ValueObject: &testUser{Name: "john", Color: "RED"}}
+	assert(t, producer.encode(message), nil)
+	value, err := NewKafkaAvroDecoder(NewCachedSchemaRegistryClient(registry.server.URL), func() interface{} { return &testUser{} }).Decode(message.Value)
+	assert(t, err, nil)
+	assert(t, value, &testUser{Name: "john", Color: "RED", Tags: []string{}})
+}
@@ -18,6 +18,8 @@ package go_kafka_client
 import (
 	"fmt"
 	"github.com/Shopify/sarama"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -40,6 +42,15 @@ type Message struct {
 
 	// Message offset.
 	Offset    int64
+
+	// Key decoded with ConsumerConfig.KeyDecoder. Nil if KeyDecoder is not set or the message has no key.
+	DecodedKey interface{}
+
+	// Value decoded with ConsumerConfig.ValueDecoder. Nil if ValueDecoder is not set.
+	DecodedValue interface{}
+
+	// Seek generation this message was fetched in, messages fetched before the latest Consumer.Seek are not processed.
+	generation int32
 }
 
 func (m *Message) String() string {
@@ -65,11 +76,15 @@ type ConsumerInfo struct {
 	Subscription map[string]int
 	Pattern      string
 	Timestamp    int64
+	// Relative capacity of the consumer used by WeightedStrategy. Consumers that did not advertise a weight have weight 0, which is treated as 1.
+	Weight int `json:",omitempty"`
+	// Arbitrary labels of the consumer (e.g. host or zone) that custom partition assignors may use.
+	Tags map[string]string `json:",omitempty"`
 }
 
 func (c *ConsumerInfo) String() string {
-	return fmt.Sprintf("{Version: %d, Subscription: %v, Pattern: %s, Timestamp: %d}",
-		c.Version, c.Subscription, c.Pattern, c.Timestamp)
+	return fmt.Sprintf("{Version: %d, Subscription: %v, Pattern: %s, Timestamp: %d, Weight: %d, Tags: %v}",
+		c.Version, c.Subscription, c.Pattern, c.Timestamp, c.Weight, c.Tags)
 }
 
 //General information about Kafka topic. Used to keep it in consumer coordinator.
@@ -105,6 +120,19 @@ func (c *ConsumerThreadId) String() string {
 	return fmt.Sprintf("%s-%d", c.Consumer, c.ThreadId)
 }
 
+// Parses a ConsumerThreadId from its string representation, e.g. as stored by a ConsumerCoordinator for a partition owner.
+func parseConsumerThreadId(consumerThreadId string) (ConsumerThreadId, error) {
+	separator := strings.LastIndex(consumerThreadId, "-")
+	if separator < 0 {
+		return ConsumerThreadId{}, fmt.Errorf("Invalid consumer thread id: %s", consumerThreadId)
+	}
+	threadId, err := strconv.Atoi(consumerThreadId[separator+1:])
+	if err != nil {
+		return ConsumerThreadId{}, fmt.Errorf("Invalid consumer thread id: %s", consumerThreadId)
+	}
+	return ConsumerThreadId{consumerThreadId[:separator], threadId}, nil
+}
+
 type byName []ConsumerThreadId
 
 func (a byName) Len() int      { return len(a) }
@@ -165,6 +193,8 @@ func (b *brokerAndFetcherId) String() string {
 type TopicPartitionData struct {
 	TopicPartition TopicAndPartition
 	Data           *sarama.FetchResponseBlock
+	// Offset the data was fetched from.
+	FetchOffset int64
 }
 
 // DeployedTopics contain information needed to do a successful blue-green deployment.
@@ -182,15 +212,27 @@ func (s intArray) Len() int           { return len(s) }
 func (s intArray) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s intArray) Less(i, j int) bool { return s[i] < s[j] }
 
+type byTopicAndPartition []TopicAndPartition
+
+func (a byTopicAndPartition) Len() int      { return len(a) }
+func (a byTopicAndPartition) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTopicAndPartition) Less(i, j int) bool {
+	if a[i].Topic != a[j].Topic {
+		return a[i].Topic < a[j].Topic
+	}
+	return a[i].Partition < a[j].Partition
+}
+
 // ConsumerCoordinator is used to coordinate actions of multiple consumers within the same consumer group.
-// It is responsible for keeping track of alive consumers, manages their offsets and assigns partitions to consume.
+// It is responsible for keeping track of alive consumers and assigns partitions to consume. Offsets are kept separately in OffsetStore.
 // The current default ConsumerCoordinator is ZookeeperCoordinator. More of them can be added in future.
 type ConsumerCoordinator interface {
 	/* Establish connection to this ConsumerCoordinator. Returns an error if fails to connect, nil otherwise. */
 	Connect() error
 
-	/* Registers a new consumer with Consumerid id and TopicCount subscription that is a part of consumer group Group in this ConsumerCoordinator. Returns an error if registration failed, nil otherwise. */
-	RegisterConsumer(Consumerid string, Group string, TopicCount TopicsToNumStreams) error
+	/* Registers a new consumer with Consumerid id and TopicCount subscription that is a part of consumer group Group in this ConsumerCoordinator.
+	Weight and Tags are advertised to partition assignors of the group in ConsumerInfo. Returns an error if registration failed, nil otherwise. */
+	RegisterConsumer(Consumerid string, Group string, TopicCount TopicsToNumStreams, Weight int, Tags map[string]string) error
 
 	/* Deregisters consumer with Consumerid id that is a part of consumer group Group form this ConsumerCoordinator. Returns an error if deregistration failed, nil otherwise. */
 	DeregisterConsumer(Consumerid string, Group string) error
@@ -217,10 +259,6 @@ type ConsumerCoordinator interface {
 	Returns a slice of BrokerInfo and error on failure. */
 	GetAllBrokers() ([]*BrokerInfo, error)
 
-	/* Gets the offset for a given TopicPartition and consumer group Group.
-	Returns offset on sucess, error otherwise. */
-	GetOffsetForTopicPartition(Group string, TopicPartition *TopicAndPartition) (int64, error)
-
 	/* Notifies consumer group about new deployed topic, which should be taken after current one is exhausted */
 	NotifyConsumerGroup(Group string, ConsumerId string) error
 
@@ -246,9 +284,25 @@ type ConsumerCoordinator interface {
 	Returns error if failed to released partition ownership. */
 	ReleasePartitionOwnership(Group string, Topic string, Partition int32) error
 
-	/* Tells the ConsumerCoordinator to commit offset Offset for topic and partition TopicPartition for consumer group Group.
+	/* Gets the current owners of all claimed partitions of given Topics within consumer group Group.
+	Returns a map where keys are topic-partitions and values are consumer thread ids that claimed them, and error on failure. Partitions nobody owns are not in the map. */
+	GetPartitionOwners(Group string, Topics []string) (map[TopicAndPartition]ConsumerThreadId, error)
+}
+
+// OffsetStore is used to fetch and commit consumer offsets. It is independent of ConsumerCoordinator, so offsets may live anywhere,
+// e.g. in Zookeeper, in Kafka, in a local file or next to the data produced by a consumer.
+// Offsets are committed as the offset of the last processed message for a given topic and partition.
+type OffsetStore interface {
+	/* Gets the offset for a given TopicPartition and consumer group Group.
+	Returns InvalidOffset if there is no committed offset for a given TopicPartition and error on failure. */
+	GetOffset(Group string, TopicPartition *TopicAndPartition) (int64, error)
+
+	/* Commits offset Offset for topic and partition TopicPartition for consumer group Group.
 	Returns error if failed to commit offset. */
 	CommitOffset(Group string, TopicPartition *TopicAndPartition, Offset int64) error
+
+	/* Releases any resources held by this OffsetStore. Called once a Consumer is closed and all offsets are committed. */
+	Close() error
 }
 
 // CoordinatorEvent is sent by consumer coordinator representing some state change.
@@ -268,4 +322,6 @@ type StateSnapshot struct {
 	Metrics map[string]map[string]float64
 	// Offsets are a map where keys are topics and values are maps where keys are partitions and values are offsets for these topic-partitions.
 	Offsets map[string]map[int32]int64
+	// Lags are a map where keys are topics and values are maps where keys are partitions and values are lags for these topic-partitions.
+	Lags map[string]map[int32]*PartitionLag
 }
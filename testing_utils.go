@@ -16,13 +16,22 @@
 package go_kafka_client
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"github.com/samuel/go-zookeeper/zk"
-	"github.com/stealthly/go-kafka/producer"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -145,10 +154,15 @@ func receiveNoMessages(t *testing.T, timeout time.Duration, from <-chan []*Messa
 }
 
 func produceN(t *testing.T, n int, topic string, brokerAddr string) {
-	p := producer.NewKafkaProducer(topic, []string{brokerAddr})
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{brokerAddr}
+	p, err := NewKafkaProducer(config)
+	if err != nil {
+		t.Fatalf("Failed to create producer: %s", err)
+	}
 	for i := 0; i < n; i++ {
 		message := fmt.Sprintf("test-kafka-message-%d", i)
-		if err := p.SendStringSync(message); err != nil {
+		if err := p.Send(&ProducerMessage{Topic: topic, Value: []byte(message)}); err != nil {
 			t.Fatalf("Failed to produce message %s because: %s", message, err)
 		}
 	}
@@ -222,3 +236,284 @@ func EnsureHasLeader(zkConnect string, topic string) {
 		}
 	}
 }
+
+//mockKafkaBroker is a fake Kafka broker that accepts any number of connections and answers each request with the next raw response body from its queue.
+//Response bodies should not contain length and correlation id, mockKafkaBroker adds them itself.
+//sarama.MockBroker is not used here as it cannot encode consumer metadata and offset responses.
+type mockKafkaBroker struct {
+	t         *testing.T
+	listener  net.Listener
+	host      string
+	port      int32
+	responses chan []byte
+	requests  chan []byte
+}
+
+func newMockKafkaBroker(t *testing.T) *mockKafkaBroker {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &mockKafkaBroker{
+		t:         t,
+		listener:  listener,
+		host:      host,
+		port:      int32(port),
+		responses: make(chan []byte, 100),
+		requests:  make(chan []byte, 100),
+	}
+	go broker.acceptLoop()
+
+	return broker
+}
+
+func (b *mockKafkaBroker) BrokerInfo(id int32) *BrokerInfo {
+	return &BrokerInfo{Id: id, Host: b.host, Port: uint32(b.port)}
+}
+
+func (b *mockKafkaBroker) Returns(response []byte) {
+	b.responses <- response
+}
+
+//Returns the next request body received by this broker. Request body starts with api key.
+func (b *mockKafkaBroker) NextRequest(timeout time.Duration) []byte {
+	select {
+	case request := <-b.requests:
+		return request
+	case <-time.After(timeout):
+		b.t.Errorf("Mock broker did not receive a request within %s", timeout)
+		return nil
+	}
+}
+
+func (b *mockKafkaBroker) Close() {
+	b.listener.Close()
+}
+
+func (b *mockKafkaBroker) acceptLoop() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(conn)
+	}
+}
+
+func (b *mockKafkaBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		b.requests <- body
+
+		var response []byte
+		select {
+		case response = <-b.responses:
+		case <-time.After(5 * time.Second):
+			return
+		}
+		responseHeader := make([]byte, 8)
+		binary.BigEndian.PutUint32(responseHeader, uint32(len(response)+4))
+		copy(responseHeader[4:], body[4:8])
+		if _, err := conn.Write(append(responseHeader, response...)); err != nil {
+			return
+		}
+	}
+}
+
+//kafkaEncoder builds raw Kafka protocol bodies for mockKafkaBroker.
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int16(value int16) *kafkaEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *kafkaEncoder) int32(value int32) *kafkaEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *kafkaEncoder) int64(value int64) *kafkaEncoder {
+	binary.Write(e, binary.BigEndian, value)
+	return e
+}
+
+func (e *kafkaEncoder) string(value string) *kafkaEncoder {
+	e.int16(int16(len(value)))
+	e.WriteString(value)
+	return e
+}
+
+//kafkaDecoder reads raw Kafka protocol bodies received by mockKafkaBroker.
+type kafkaDecoder struct {
+	*bytes.Reader
+}
+
+func newKafkaDecoder(body []byte) *kafkaDecoder {
+	return &kafkaDecoder{bytes.NewReader(body)}
+}
+
+func (d *kafkaDecoder) int16() (value int16) {
+	binary.Read(d, binary.BigEndian, &value)
+	return
+}
+
+func (d *kafkaDecoder) int32() (value int32) {
+	binary.Read(d, binary.BigEndian, &value)
+	return
+}
+
+func (d *kafkaDecoder) int64() (value int64) {
+	binary.Read(d, binary.BigEndian, &value)
+	return
+}
+
+func (d *kafkaDecoder) string() string {
+	value := make([]byte, d.int16())
+	d.Read(value)
+	return string(value)
+}
+
+func (d *kafkaDecoder) int8() (value int8) {
+	binary.Read(d, binary.BigEndian, &value)
+	return
+}
+
+func (d *kafkaDecoder) bytes() []byte {
+	length := d.int32()
+	if length < 0 {
+		return nil
+	}
+	value := make([]byte, length)
+	d.Read(value)
+	return value
+}
+
+//mockOffsetStore is a MemoryOffsetStore that remembers whether it was closed.
+type mockOffsetStore struct {
+	*MemoryOffsetStore
+	closed bool
+}
+
+func newMockOffsetStore() *mockOffsetStore {
+	return &mockOffsetStore{MemoryOffsetStore: NewMemoryOffsetStore()}
+}
+
+func (s *mockOffsetStore) Close() error {
+	s.closed = true
+	return s.MemoryOffsetStore.Close()
+}
+
+//mockProducer is a Producer that keeps sent messages in memory, fails with a given error if it is set and remembers whether it was closed.
+type mockProducer struct {
+	messages []*ProducerMessage
+	err      error
+	closed   bool
+	lock     sync.Mutex
+}
+
+func newMockProducer() *mockProducer {
+	return &mockProducer{
+		messages: make([]*ProducerMessage, 0),
+	}
+}
+
+func (p *mockProducer) Send(message *ProducerMessage) error {
+	var err error
+	inLock(&p.lock, func() {
+		err = p.err
+		if err == nil {
+			p.messages = append(p.messages, message)
+		}
+	})
+	return err
+}
+
+func (p *mockProducer) SendAsync(message *ProducerMessage, callback DeliveryCallback) {
+	err := p.Send(message)
+	if callback != nil {
+		callback(message, err)
+	}
+}
+
+func (p *mockProducer) Close() error {
+	inLock(&p.lock, func() {
+		p.closed = true
+	})
+	return nil
+}
+
+//mockSchemaRegistry is a local HTTP stand-in for a schema registry that keeps registered schemas in memory and counts received requests.
+type mockSchemaRegistry struct {
+	server   *httptest.Server
+	schemas  []string
+	requests int
+	lock     sync.Mutex
+}
+
+func newMockSchemaRegistry() *mockSchemaRegistry {
+	registry := &mockSchemaRegistry{}
+	registry.server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	return registry
+}
+
+func (r *mockSchemaRegistry) Requests() int {
+	requests := 0
+	inLock(&r.lock, func() {
+		requests = r.requests
+	})
+	return requests
+}
+
+func (r *mockSchemaRegistry) Close() {
+	r.server.Close()
+}
+
+func (r *mockSchemaRegistry) serve(w http.ResponseWriter, request *http.Request) {
+	inLock(&r.lock, func() {
+		r.requests++
+		var id int
+		fmt.Sscanf(request.URL.Path, "/schemas/ids/%d", &id)
+		switch {
+		case request.Method == "POST" && strings.HasPrefix(request.URL.Path, "/subjects/"):
+			{
+				body := make(map[string]string)
+				json.NewDecoder(request.Body).Decode(&body)
+				for i, schema := range r.schemas {
+					if schema == body["schema"] {
+						json.NewEncoder(w).Encode(map[string]int{"id": i + 1})
+						return
+					}
+				}
+				r.schemas = append(r.schemas, body["schema"])
+				json.NewEncoder(w).Encode(map[string]int{"id": len(r.schemas)})
+			}
+		case request.Method == "GET" && id > 0 && id <= len(r.schemas):
+			json.NewEncoder(w).Encode(map[string]string{"schema": r.schemas[id-1]})
+		default:
+			{
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40403, "message": "Schema not found"})
+			}
+		}
+	})
+}
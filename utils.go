@@ -152,8 +152,37 @@ func redirectChannelsTo(inputChannels interface{}, outputChannel interface{}) ch
 	return killChannel
 }
 
+// Redirects values from one channel to another until the returned channel gets a value.
+// Unlike redirectChannelsTo, a value that is not received by the time the pipe is killed is dropped, so killing a pipe does not block on a receiver that has gone, e.g. a stopped WorkerManager.
 func pipe(from interface{}, to interface{}) chan bool {
-	return redirectChannelsTo([]interface{}{from}, to)
+	input := reflect.ValueOf(from)
+	output := reflect.ValueOf(to)
+	killChannel := make(chan bool)
+
+	if input.Kind() != reflect.Chan || output.Kind() != reflect.Chan {
+		panic("Incorrect channel type")
+	}
+
+	go func() {
+		kill := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(killChannel)}
+		for {
+			chosen, value, ok := reflect.Select([]reflect.SelectCase{kill, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: input}})
+			if chosen == 0 {
+				return
+			}
+			if !ok {
+				<-killChannel
+				return
+			}
+
+			chosen, _, _ = reflect.Select([]reflect.SelectCase{kill, reflect.SelectCase{Dir: reflect.SelectSend, Chan: output, Send: value}})
+			if chosen == 0 {
+				return
+			}
+		}
+	}()
+
+	return killChannel
 }
 
 func redirectChannelsToWithTimeout(inputChannels interface{}, outputChannel interface{}, timeout time.Duration) (chan bool, <-chan time.Time) {
@@ -231,6 +260,20 @@ func newSaramaBrokerConfig(config *ConsumerConfig) *sarama.BrokerConfig {
 	return brokerConfig
 }
 
+// Converts a given time to a time-based OffsetRequest time, i.e. milliseconds since epoch.
+func offsetTimeOf(t time.Time) sarama.OffsetTime {
+	return sarama.OffsetTime(t.UnixNano() / int64(time.Millisecond))
+}
+
+// Asks Kafka for the offset of a given partition at a given time. Falls back to the earliest offset if all available messages were produced after that time.
+func getOffset(client *sarama.Client, topicPartition *TopicAndPartition, offsetTime sarama.OffsetTime) (int64, error) {
+	offset, err := client.GetOffset(topicPartition.Topic, topicPartition.Partition, offsetTime)
+	if err == sarama.OffsetOutOfRange && offsetTime >= 0 {
+		return client.GetOffset(topicPartition.Topic, topicPartition.Partition, sarama.EarliestOffset)
+	}
+	return offset, err
+}
+
 type barrier struct {
 	size               int32
 	watchers		   int32
@@ -16,16 +16,19 @@
 package go_kafka_client
 
 import (
+	"encoding/json"
 	"fmt"
 	metrics "github.com/rcrowley/go-metrics"
+	"hash/fnv"
 	"math"
+	"sort"
 	"sync"
 	"time"
 	"sync/atomic"
 )
 
 // WorkerManager is responsible for splitting the incomming batches of messages between a configured amount of workers.
-// It also keeps track of highest processed offsets and commits them to offset storage with a configurable frequency.
+// It also keeps track of processed offsets and commits the highest offset below which all messages are processed to offset storage with a configurable frequency.
 type WorkerManager struct {
 	id                  string
 	config              *ConsumerConfig
@@ -34,11 +37,21 @@ type WorkerManager struct {
 	currentBatch        map[TaskId]*Task //TODO inspect for race conditions
 	inputChannel        chan []*Message
 	topicPartition      TopicAndPartition
+	isRetryTopic        bool
+	strategy            WorkerStrategy
+	batchStrategy       BatchWorkerStrategy
 	largestOffset       int64
+	offsetTracker       *offsetTracker
+	workerQueues        map[*Worker][]*Task
+	workerQueuesLock    sync.Mutex
 	lastCommittedOffset int64
+	commitLock          sync.Mutex
+	commitFailed        func(TopicAndPartition)
+	generation          int32
 	failCounter         *FailureCounter
 	batchProcessed      chan bool
 	stopLock            sync.Mutex
+	stopped             bool
 	managerStop         chan bool
 	processingStop      chan bool
 	commitStop          chan bool
@@ -47,12 +60,47 @@ type WorkerManager struct {
 	pendingTasksCounter  metrics.Counter
 	batchDurationTimer   metrics.Timer
 	idleTimer            metrics.Timer
+	partitionMetrics     *PartitionMetrics
+}
+
+// PartitionMetrics holds processing metrics of a single topic-partition.
+type PartitionMetrics struct {
+	// Messages processed successfully.
+	Messages metrics.Meter
+
+	// Key and value bytes of messages processed successfully.
+	Bytes metrics.Meter
+
+	// Failed processing attempts, including timeouts and messages that could not be decoded.
+	Failures metrics.Meter
+
+	// Time taken by the strategy to process a single message. Each message of a batch processed with BatchStrategy takes the time of the whole batch.
+	Latency metrics.Timer
+}
+
+// Creates new PartitionMetrics that are not registered in any registry.
+func NewPartitionMetrics() *PartitionMetrics {
+	return &PartitionMetrics{
+		Messages: metrics.NewMeter(),
+		Bytes:    metrics.NewMeter(),
+		Failures: metrics.NewMeter(),
+		Latency:  metrics.NewTimer(),
+	}
+}
+
+func (pm *PartitionMetrics) markResult(message *Message, result WorkerResult) {
+	if result.Success() {
+		pm.Messages.Mark(1)
+		pm.Bytes.Mark(int64(len(message.Key) + len(message.Value)))
+	} else {
+		pm.Failures.Mark(1)
+	}
 }
 
 // Creates a new WorkerManager with given id using a given ConsumerConfig and responsible for managing given TopicAndPartition.
 func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAndPartition,
 	wmsIdleTimer metrics.Timer, batchDurationTimer metrics.Timer, activeWorkersCounter metrics.Counter,
-	pendingWMsTasksCounter metrics.Counter) *WorkerManager {
+	pendingWMsTasksCounter metrics.Counter, partitionMetrics *PartitionMetrics) *WorkerManager {
 	workers := make([]*Worker, config.NumWorkers)
 	availableWorkers := make(chan *Worker, config.NumWorkers)
 	for i := 0; i < config.NumWorkers; i++ {
@@ -63,7 +111,7 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 		availableWorkers <- workers[i]
 	}
 
-	return &WorkerManager{
+	wm := &WorkerManager{
 		id:                   id,
 		config:               config,
 		availableWorkers:     availableWorkers,
@@ -72,6 +120,9 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 		currentBatch:         make(map[TaskId]*Task),
 		topicPartition:       topicPartition,
 		largestOffset:        InvalidOffset,
+		offsetTracker:        newOffsetTracker(),
+		workerQueues:         make(map[*Worker][]*Task),
+		lastCommittedOffset:  InvalidOffset,
 		failCounter:          NewFailureCounter(config.WorkerRetryThreshold, config.WorkerThresholdTimeWindow),
 		batchProcessed:       make(chan bool),
 		managerStop:          make(chan bool),
@@ -81,7 +132,22 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 		pendingTasksCounter:  pendingWMsTasksCounter,
 		batchDurationTimer:   batchDurationTimer,
 		idleTimer:            wmsIdleTimer,
+		partitionMetrics:     partitionMetrics,
+	}
+
+	wm.strategy = wm.timedStrategy(config.Strategy)
+	wm.batchStrategy = wm.timedBatchStrategy(config.BatchStrategy)
+	if config.KeyDecoder != nil || config.ValueDecoder != nil {
+		wm.strategy = wm.decodingStrategy(wm.strategy)
+		wm.batchStrategy = wm.decodingBatchStrategy(wm.batchStrategy)
 	}
+	if _, _, isRetryTopic := parseRetryTopic(topicPartition.Topic, config.RetryTopicDelays); isRetryTopic {
+		wm.isRetryTopic = true
+		wm.strategy = wm.retryStrategy(wm.strategy)
+		wm.batchStrategy = wm.retryBatchStrategy(wm.batchStrategy)
+	}
+
+	return wm
 }
 
 func (wm *WorkerManager) String() string {
@@ -89,9 +155,29 @@ func (wm *WorkerManager) String() string {
 }
 
 // Starts processing incoming batches with this WorkerManager. Processing is possible only in batch-at-once mode.
-// It also launches an offset committer routine.
+// It also launches an offset committer routine. A stopped WorkerManager can be started again.
 // Call to this method blocks.
 func (wm *WorkerManager) Start() {
+	inLock(&wm.stopLock, func() {
+		wm.stopped = false
+	})
+	wm.run()
+}
+
+// Starts this WorkerManager again in background if it was stopped. Returns false if it is already running.
+func (wm *WorkerManager) restart() bool {
+	restarted := false
+	inLock(&wm.stopLock, func() {
+		if wm.stopped {
+			wm.stopped = false
+			restarted = true
+			go wm.run()
+		}
+	})
+	return restarted
+}
+
+func (wm *WorkerManager) run() {
 	go wm.processBatch()
 	go wm.commitBatch()
 	for {
@@ -101,9 +187,19 @@ func (wm *WorkerManager) Start() {
 			{
 				wm.idleTimer.Update(time.Since(startIdle))
 				Debug(wm, "WorkerManager got batch")
+				batch = wm.dropSeekedMessages(batch)
+				if len(batch) == 0 {
+					continue
+				}
+				if !wm.waitForRetryDelay(batch) {
+					return
+				}
 				wm.batchDurationTimer.Time(func() {
 					wm.startBatch(batch)
 				})
+				if wm.config.OffsetCommitMode == BatchCommit {
+					wm.autoCommitOffset()
+				}
 				Debug(wm, "WorkerManager got batch processed")
 			}
 		case <-wm.managerStop:
@@ -113,12 +209,17 @@ func (wm *WorkerManager) Start() {
 }
 
 // Tells this WorkerManager to finish processing current batch, stop accepting new work and shut down.
-// This method returns immediately and returns a channel which will get the value once the shut down is finished.
+// This method returns immediately and returns a channel which will get the value once the shut down is finished, or right away if it is already stopped.
 func (wm *WorkerManager) Stop() chan bool {
 	finished := make(chan bool)
 	go func() {
 		Debugf(wm, "Trying to stop workerManager")
 		inLock(&wm.stopLock, func() {
+			if wm.stopped {
+				Debug(wm, "Manager is already stopped")
+				finished <- true
+				return
+			}
 			Debug(wm, "Stopping manager")
 			wm.managerStop <- true
 			Debug(wm, "Stopping processor")
@@ -126,7 +227,9 @@ func (wm *WorkerManager) Stop() chan bool {
 			Debug(wm, "Successful manager stop")
 			Debug(wm, "Stopping committer")
 			wm.commitStop <- true
+			<-wm.commitStop
 			Debug(wm, "Successful committer stop")
+			wm.stopped = true
 			finished <- true
 			Debug(wm, "Leaving manager stop")
 		})
@@ -141,60 +244,240 @@ func (wm *WorkerManager) startBatch(batch []*Message) {
 		for _, message := range batch {
 			topicPartition := TopicAndPartition{message.Topic, message.Partition}
 			wm.currentBatch[TaskId{topicPartition, message.Offset}] = &Task{Msg: message}
+			wm.offsetTracker.add(message.Offset)
 		}
 		wm.pendingTasksCounter.Inc(int64(len(wm.currentBatch)))
-		for _, task := range wm.currentBatch {
-			worker := <-wm.availableWorkers
-			wm.activeWorkersCounter.Inc(1)
-			wm.pendingTasksCounter.Dec(1)
-			worker.Start(task, wm.config.Strategy)
+		if wm.config.BatchStrategy != nil {
+			wm.processWholeBatch(batch)
+			return
+		} else if wm.config.KeyOrderedProcessing {
+			wm.startKeyOrderedBatch(batch)
+		} else {
+			for _, task := range wm.currentBatch {
+				worker := <-wm.availableWorkers
+				wm.activeWorkersCounter.Inc(1)
+				wm.pendingTasksCounter.Dec(1)
+				worker.Start(task, wm.strategy)
+			}
 		}
 
 		<-wm.batchProcessed
 	})
 }
 
+// Splits the batch into per-worker queues so that all messages with the same key are processed by one worker in offset order.
+// Only the head of each queue is started here, the rest are started one by one as the worker finishes previous tasks.
+func (wm *WorkerManager) startKeyOrderedBatch(batch []*Message) {
+	queues := make([][]*Task, wm.config.NumWorkers)
+	keyless := 0
+	for _, message := range batch {
+		task := wm.currentBatch[TaskId{TopicAndPartition{message.Topic, message.Partition}, message.Offset}]
+		var queue int
+		if len(message.Key) == 0 {
+			queue = keyless % wm.config.NumWorkers
+			keyless++
+		} else {
+			hash := fnv.New32a()
+			hash.Write(message.Key)
+			queue = int(hash.Sum32() % uint32(wm.config.NumWorkers))
+		}
+		queues[queue] = append(queues[queue], task)
+	}
+
+	for _, queue := range queues {
+		if len(queue) == 0 {
+			continue
+		}
+		worker := <-wm.availableWorkers
+		wm.activeWorkersCounter.Inc(1)
+		wm.pendingTasksCounter.Dec(1)
+		inLock(&wm.workerQueuesLock, func() {
+			wm.workerQueues[worker] = queue[1:]
+		})
+		worker.Start(queue[0], wm.strategy)
+	}
+}
+
+// Processes the whole batch with a single worker using BatchStrategy. Failed tasks are retried together until they succeed,
+// run out of retries or a FailedDecision tells to stop processing the batch. Call to this method blocks until the batch is done.
+func (wm *WorkerManager) processWholeBatch(batch []*Message) {
+	tasks := make([]*Task, 0, len(batch))
+	for _, message := range batch {
+		tasks = append(tasks, wm.currentBatch[TaskId{TopicAndPartition{message.Topic, message.Partition}, message.Offset}])
+	}
+
+	worker := <-wm.availableWorkers
+	wm.activeWorkersCounter.Inc(1)
+	wm.pendingTasksCounter.Dec(int64(len(tasks)))
+	defer func() {
+		wm.currentBatch = make(map[TaskId]*Task)
+		wm.availableWorkers <- worker
+		wm.activeWorkersCounter.Dec(1)
+	}()
+
+	for len(tasks) > 0 {
+		failedTasks := make([]*Task, 0)
+		stop := false
+		for i, result := range worker.ProcessBatch(tasks, wm.batchStrategy) {
+			task := tasks[i]
+			wm.partitionMetrics.markResult(task.Msg, result)
+			if result.Success() {
+				wm.offsetIsDone(task.Msg.Offset)
+				continue
+			}
+
+			Warnf(wm, "Worker task %s has failed", result.Id())
+			task.Retries++
+			if task.Retries <= wm.config.MaxWorkerRetries && !isDecodingFailure(result) {
+				failedTasks = append(failedTasks, task)
+				continue
+			}
+
+			Errorf(wm, "Worker task %s has failed after %d retries", result.Id(), wm.config.MaxWorkerRetries)
+			if stop {
+				continue
+			}
+			switch wm.failedDecision(task, result) {
+			case CommitOffsetAndContinue:
+				wm.offsetIsDone(task.Msg.Offset)
+			case DoNotCommitOffsetAndContinue:
+				wm.offsetIsAbandoned(task.Msg.Offset)
+			case SendToDeadLetterTopicAndContinue:
+				if wm.sendToDeadLetterTopic(task, result) {
+					wm.offsetIsDone(task.Msg.Offset)
+				} else {
+					wm.offsetIsAbandoned(task.Msg.Offset)
+				}
+			case SendToRetryTopicAndContinue:
+				if wm.sendToRetryTopic(task, result) {
+					wm.offsetIsDone(task.Msg.Offset)
+				} else {
+					wm.offsetIsAbandoned(task.Msg.Offset)
+				}
+			case CommitOffsetAndStop:
+				wm.offsetIsDone(task.Msg.Offset)
+				stop = true
+			case DoNotCommitOffsetAndStop:
+				stop = true
+			}
+		}
+
+		if stop {
+			wm.abandonInFlightOffsets()
+			return
+		}
+		if len(failedTasks) > 0 {
+			Warnf(wm, "Retrying %d failed worker tasks", len(failedTasks))
+			time.Sleep(wm.config.WorkerBackoff)
+		}
+		tasks = failedTasks
+	}
+}
+
+// Hands the next queued task to a given worker if there is one (key-ordered processing) or returns the worker to the pool of available workers otherwise.
+func (wm *WorkerManager) releaseWorker(worker *Worker) {
+	var next *Task
+	inLock(&wm.workerQueuesLock, func() {
+		if queue := wm.workerQueues[worker]; len(queue) > 0 {
+			next = queue[0]
+			wm.workerQueues[worker] = queue[1:]
+		} else {
+			delete(wm.workerQueues, worker)
+		}
+	})
+
+	if next != nil {
+		wm.pendingTasksCounter.Dec(1)
+		worker.Start(next, wm.strategy)
+		return
+	}
+	wm.availableWorkers <- worker
+	wm.activeWorkersCounter.Dec(1)
+}
+
 func (wm *WorkerManager) commitBatch() {
 	for {
+		var interval <-chan time.Time
+		if wm.config.OffsetCommitMode == IntervalCommit {
+			interval = time.After(wm.config.OffsetCommitInterval)
+		}
 		select {
 		case <-wm.commitStop:
 			{
-				wm.commitOffset()
+				if wm.config.OffsetCommitMode != ManualCommit {
+					wm.autoCommitOffset()
+				}
+				wm.commitStop <- true
 				return
 			}
-		case <-time.After(wm.config.OffsetCommitInterval):
+		case <-interval:
 			{
-				wm.commitOffset()
+				wm.autoCommitOffset()
 			}
 		}
 	}
 }
 
-func (wm *WorkerManager) commitOffset() {
-	largestOffset := wm.GetLargestOffset()
-	Tracef(wm, "Inside commit offset with largest %d and last %d", largestOffset, wm.lastCommittedOffset)
-	if largestOffset <= wm.lastCommittedOffset || isOffsetInvalid(largestOffset) {
-		return
+// Commits processed offsets without being asked to and reports a persistent commit failure to the consumer so it can apply ConsumerConfig.CommitFailurePolicy.
+func (wm *WorkerManager) autoCommitOffset() {
+	if err := wm.commitOffset(); err != nil && wm.commitFailed != nil {
+		wm.commitFailed(wm.topicPartition)
+	}
+}
+
+// Commits the highest offset below which all messages are processed if it was not committed yet.
+func (wm *WorkerManager) commitOffset() error {
+	var err error
+	inLock(&wm.commitLock, func() {
+		err = wm.tryCommitOffset()
+	})
+	return err
+}
+
+func (wm *WorkerManager) tryCommitOffset() error {
+	offsetToCommit := wm.GetCommittableOffset()
+	Tracef(wm, "Inside commit offset with committable %d and last %d", offsetToCommit, wm.lastCommittedOffset)
+	if offsetToCommit <= wm.lastCommittedOffset || isOffsetInvalid(offsetToCommit) {
+		return nil
 	}
 
-	success := false
+	return wm.commitWithRetries(offsetToCommit)
+}
+
+// Commits a given offset regardless of which messages are processed, e.g. to commit a position a transactional sink has stored.
+func (wm *WorkerManager) commit(offset int64) error {
+	var err error
+	inLock(&wm.commitLock, func() {
+		err = wm.commitWithRetries(offset)
+	})
+	return err
+}
+
+// Commits a given offset retrying up to OffsetsCommitMaxRetries times with an exponential backoff and reports the result to ConsumerConfig.OnCommit.
+func (wm *WorkerManager) commitWithRetries(offset int64) error {
+	var err error
+	backoff := wm.config.OffsetsCommitBackoff
 	for i := 0; i <= wm.config.OffsetsCommitMaxRetries; i++ {
-		err := wm.config.Coordinator.CommitOffset(wm.config.Groupid, &wm.topicPartition, largestOffset)
+		if i > 0 {
+			Infof(wm, "Failed to commit offset %d for %s: %s. Retrying in %s...", offset, &wm.topicPartition, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = wm.config.OffsetStore.CommitOffset(wm.config.Groupid, &wm.topicPartition, offset)
 		if err == nil {
-			success = true
-			Debugf(wm, "Successfully committed offset %d for %s", largestOffset, wm.topicPartition)
+			Debugf(wm, "Successfully committed offset %d for %s", offset, wm.topicPartition)
+			atomic.StoreInt64(&wm.lastCommittedOffset, offset)
 			break
-		} else {
-			Infof(wm, "Failed to commit offset %d for %s. Retying...", largestOffset, &wm.topicPartition)
 		}
 	}
 
-	if !success {
-		Errorf(wm, "Failed to commit offset %d for %s after %d retries", largestOffset, &wm.topicPartition, wm.config.OffsetsCommitMaxRetries)
-		//TODO: what to do next?
-	} else {
-		wm.lastCommittedOffset = largestOffset
+	if err != nil {
+		Errorf(wm, "Failed to commit offset %d for %s after %d retries: %s", offset, &wm.topicPartition, wm.config.OffsetsCommitMaxRetries, err)
+	}
+	if wm.config.OnCommit != nil {
+		wm.config.OnCommit(wm.topicPartition, offset, err)
 	}
+	return err
 }
 
 // Asks this WorkerManager whether the current batch is fully processed. Returns true if so, false otherwise.
@@ -219,6 +502,9 @@ func (wm *WorkerManager) processBatch() {
 				}()
 
 				task := wm.currentBatch[result.Id()]
+				if task != nil {
+					wm.partitionMetrics.markResult(task.Msg, result)
+				}
 				if result.Success() {
 					wm.taskIsDone(result)
 				} else {
@@ -228,24 +514,33 @@ func (wm *WorkerManager) processBatch() {
 
 					Warnf(wm, "Worker task %s has failed", result.Id())
 					task.Retries++
-					if task.Retries > wm.config.MaxWorkerRetries {
+					if task.Retries > wm.config.MaxWorkerRetries || isDecodingFailure(result) {
 						Errorf(wm, "Worker task %s has failed after %d retries", result.Id(), wm.config.MaxWorkerRetries)
 
-						var decision FailedDecision
-						if wm.failCounter.Failed() {
-							decision = wm.config.WorkerFailureCallback(wm)
-						} else {
-							decision = wm.config.WorkerFailedAttemptCallback(task, result)
-						}
-						switch decision {
+						switch wm.failedDecision(task, result) {
 						case CommitOffsetAndContinue:
 							{
 								wm.taskIsDone(result)
 							}
 						case DoNotCommitOffsetAndContinue:
 							{
-								wm.availableWorkers <- wm.currentBatch[result.Id()].Callee
-								delete(wm.currentBatch, result.Id())
+								wm.taskIsAbandoned(result)
+							}
+						case SendToDeadLetterTopicAndContinue:
+							{
+								if wm.sendToDeadLetterTopic(task, result) {
+									wm.taskIsDone(result)
+								} else {
+									wm.taskIsAbandoned(result)
+								}
+							}
+						case SendToRetryTopicAndContinue:
+							{
+								if wm.sendToRetryTopic(task, result) {
+									wm.taskIsDone(result)
+								} else {
+									wm.taskIsAbandoned(result)
+								}
 							}
 						case CommitOffsetAndStop:
 							{
@@ -260,7 +555,7 @@ func (wm *WorkerManager) processBatch() {
 					} else {
 						Warnf(wm, "Retrying worker task %s %dth time", result.Id(), task.Retries)
 						time.Sleep(wm.config.WorkerBackoff)
-						go task.Callee.Start(task, wm.config.Strategy)
+						go task.Callee.Start(task, wm.strategy)
 					}
 				}
 
@@ -282,18 +577,307 @@ func (wm *WorkerManager) processBatch() {
 	}
 }
 
+func isDecodingFailure(result WorkerResult) bool {
+	_, decodingFailed := result.(*DecodingFailedResult)
+	return decodingFailed
+}
+
+func (wm *WorkerManager) offsetIsDone(offset int64) {
+	Tracef(wm, "Task is done: %d", offset)
+	if wm.offsetTracker.complete(offset) {
+		wm.UpdateLargestOffset(offset)
+	}
+}
+
+// Marks a given offset as failed and not to be committed. As offsets are committed contiguously, no offsets after it are committed until the consumer restarts.
+func (wm *WorkerManager) offsetIsAbandoned(offset int64) {
+	if wm.offsetTracker.abandon(offset) {
+		Warnf(wm, "Offset %d is not committed, committed offset is stuck before offset %d until the consumer restarts", offset, wm.GetStuckOffset())
+	}
+}
+
+// Marks all offsets that are still being processed as not to be committed, e.g. when the rest of the batch is stopped.
+func (wm *WorkerManager) abandonInFlightOffsets() {
+	if abandoned := wm.offsetTracker.abandonInFlight(); abandoned > 0 {
+		Warnf(wm, "%d offsets of the stopped batch are not committed, committed offset is stuck before offset %d until the consumer restarts", abandoned, wm.GetStuckOffset())
+	}
+}
+
+// Repositions this WorkerManager so that a given offset is the next one to process. Messages of seek generations before a given one are not processed anymore.
+// Offsets before the given one are considered processed and the one right before it is committed, so the new position is kept if the consumer restarts.
+func (wm *WorkerManager) seek(offset int64, generation int32) error {
+	atomic.StoreInt32(&wm.generation, generation)
+	var err error
+	inLock(&wm.commitLock, func() {
+		wm.offsetTracker.reset(offset - 1)
+		atomic.StoreInt64(&wm.largestOffset, offset-1)
+		if isOffsetInvalid(offset - 1) {
+			atomic.StoreInt64(&wm.lastCommittedOffset, InvalidOffset)
+			return
+		}
+
+		err = wm.config.OffsetStore.CommitOffset(wm.config.Groupid, &wm.topicPartition, offset-1)
+		if err == nil {
+			Infof(wm, "Committed offset %d after seeking to offset %d", offset-1, offset)
+			atomic.StoreInt64(&wm.lastCommittedOffset, offset-1)
+		}
+	})
+	return err
+}
+
+// Returns messages of a given batch that were fetched after the latest seek.
+func (wm *WorkerManager) dropSeekedMessages(batch []*Message) []*Message {
+	generation := atomic.LoadInt32(&wm.generation)
+	messages := make([]*Message, 0, len(batch))
+	for _, message := range batch {
+		if message.generation >= generation {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) < len(batch) {
+		Infof(wm, "Dropped %d messages fetched before seeking", len(batch)-len(messages))
+	}
+	return messages
+}
+
+func (wm *WorkerManager) failedDecision(task *Task, result WorkerResult) FailedDecision {
+	if wm.failCounter.Failed() {
+		return wm.config.WorkerFailureCallback(wm)
+	}
+	return wm.config.WorkerFailedAttemptCallback(task, result)
+}
+
+// Sends a failed task to ConsumerConfig.DeadLetterTopic. Returns true if the message was sent and its offset can be committed.
+func (wm *WorkerManager) sendToDeadLetterTopic(task *Task, result WorkerResult) bool {
+	if wm.config.DeadLetterTopic == "" || wm.config.DeadLetterProducer == nil {
+		Errorf(wm, "Cannot send worker task %s to dead letter topic as dead letter topic is not configured", result.Id())
+		return false
+	}
+
+	if retry := wm.delayedRetry(task.Msg); retry != nil {
+		task = &Task{Msg: retry.Message(), Retries: task.Retries, Callee: task.Callee}
+	}
+	value, err := json.Marshal(NewDeadLetter(task, result))
+	if err != nil {
+		Errorf(wm, "Failed to encode dead letter for worker task %s: %s", result.Id(), err)
+		return false
+	}
+
+	err = wm.config.DeadLetterProducer.Send(&ProducerMessage{Topic: wm.config.DeadLetterTopic, Key: task.Msg.Key, Value: value})
+	if err != nil {
+		Errorf(wm, "Failed to send worker task %s to dead letter topic %s: %s", result.Id(), wm.config.DeadLetterTopic, err)
+		return false
+	}
+
+	Infof(wm, "Sent worker task %s to dead letter topic %s", result.Id(), wm.config.DeadLetterTopic)
+	return true
+}
+
+// Sends a failed task to the next retry topic according to ConsumerConfig.RetryTopicDelays or to ConsumerConfig.DeadLetterTopic if there are no more retry topics.
+// Returns true if the message was sent and its offset can be committed.
+func (wm *WorkerManager) sendToRetryTopic(task *Task, result WorkerResult) bool {
+	if len(wm.config.RetryTopicDelays) == 0 || wm.config.RetryProducer == nil {
+		Errorf(wm, "Cannot send worker task %s to retry topic as retry topics are not configured", result.Id())
+		return false
+	}
+
+	message := task.Msg
+	attempt := 0
+	if retry := wm.delayedRetry(task.Msg); retry != nil {
+		message = retry.Message()
+		attempt = retry.Attempt
+	}
+	if attempt >= len(wm.config.RetryTopicDelays) {
+		Warnf(wm, "Worker task %s has used all %d retry topics", result.Id(), attempt)
+		return wm.sendToDeadLetterTopic(task, result)
+	}
+
+	delay := wm.config.RetryTopicDelays[attempt]
+	retry := &DelayedRetry{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Reason:    failureReason(result),
+		Attempt:   attempt + 1,
+		RetryAt:   time.Now().Add(delay),
+	}
+	value, err := json.Marshal(retry)
+	if err != nil {
+		Errorf(wm, "Failed to encode delayed retry for worker task %s: %s", result.Id(), err)
+		return false
+	}
+
+	retryTopic := RetryTopic(message.Topic, delay)
+	err = wm.config.RetryProducer.Send(&ProducerMessage{Topic: retryTopic, Key: message.Key, Value: value})
+	if err != nil {
+		Errorf(wm, "Failed to send worker task %s to retry topic %s: %s", result.Id(), retryTopic, err)
+		return false
+	}
+
+	Infof(wm, "Sent worker task %s to retry topic %s", result.Id(), retryTopic)
+	return true
+}
+
+// Decodes a DelayedRetry envelope if this WorkerManager consumes a retry topic. Returns nil otherwise or if the message is not a valid envelope.
+func (wm *WorkerManager) delayedRetry(message *Message) *DelayedRetry {
+	if !wm.isRetryTopic {
+		return nil
+	}
+
+	retry := &DelayedRetry{}
+	if err := json.Unmarshal(message.Value, retry); err != nil {
+		Warnf(wm, "Message at offset %d is not a valid delayed retry: %s", message.Offset, err)
+		return nil
+	}
+	return retry
+}
+
+// Waits until all messages in a batch from a retry topic are due. Returns false if this WorkerManager was stopped while waiting.
+func (wm *WorkerManager) waitForRetryDelay(batch []*Message) bool {
+	if !wm.isRetryTopic {
+		return true
+	}
+
+	var retryAt time.Time
+	for _, message := range batch {
+		if retry := wm.delayedRetry(message); retry != nil && retry.RetryAt.After(retryAt) {
+			retryAt = retry.RetryAt
+		}
+	}
+
+	delay := retryAt.Sub(time.Now())
+	if delay <= 0 {
+		return true
+	}
+
+	Debugf(wm, "Waiting %s before retrying batch", delay)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-wm.managerStop:
+		return false
+	}
+}
+
+// Wraps a given strategy so that messages from retry topics are unwrapped from DelayedRetry envelopes before they are processed.
+func (wm *WorkerManager) retryStrategy(strategy WorkerStrategy) WorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, message *Message, id TaskId) WorkerResult {
+		if retry := wm.delayedRetry(message); retry != nil {
+			message = retry.Message()
+		}
+		return strategy(worker, message, id)
+	}
+}
+
+func (wm *WorkerManager) retryBatchStrategy(strategy BatchWorkerStrategy) BatchWorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, messages []*Message, ids []TaskId) []WorkerResult {
+		originalMessages := make([]*Message, len(messages))
+		for i, message := range messages {
+			originalMessages[i] = message
+			if retry := wm.delayedRetry(message); retry != nil {
+				originalMessages[i] = retry.Message()
+			}
+		}
+		return strategy(worker, originalMessages, ids)
+	}
+}
+
+// Wraps a given strategy so that message keys and values are decoded with KeyDecoder and ValueDecoder before they are processed.
+func (wm *WorkerManager) decodingStrategy(strategy WorkerStrategy) WorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, message *Message, id TaskId) WorkerResult {
+		if err := decodeMessage(wm.config, message); err != nil {
+			Warnf(wm, "Failed to decode message %s: %s", message, err)
+			return NewDecodingFailedResult(id, err)
+		}
+		return strategy(worker, message, id)
+	}
+}
+
+// Wraps a given batch strategy so that only successfully decoded messages are passed to it.
+func (wm *WorkerManager) decodingBatchStrategy(strategy BatchWorkerStrategy) BatchWorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, messages []*Message, ids []TaskId) []WorkerResult {
+		results := make([]WorkerResult, 0, len(messages))
+		decodedMessages := make([]*Message, 0, len(messages))
+		decodedIds := make([]TaskId, 0, len(ids))
+		for i, message := range messages {
+			if err := decodeMessage(wm.config, message); err != nil {
+				Warnf(wm, "Failed to decode message %s: %s", message, err)
+				results = append(results, NewDecodingFailedResult(ids[i], err))
+				continue
+			}
+			decodedMessages = append(decodedMessages, message)
+			decodedIds = append(decodedIds, ids[i])
+		}
+		if len(decodedMessages) == 0 {
+			return results
+		}
+		return append(results, strategy(worker, decodedMessages, decodedIds)...)
+	}
+}
+
+// Wraps a given strategy so that the time it takes to process each message is recorded in PartitionMetrics.Latency.
+func (wm *WorkerManager) timedStrategy(strategy WorkerStrategy) WorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, message *Message, id TaskId) WorkerResult {
+		start := time.Now()
+		defer wm.partitionMetrics.Latency.UpdateSince(start)
+		return strategy(worker, message, id)
+	}
+}
+
+// Wraps a given batch strategy so that the time it takes to process a batch is recorded in PartitionMetrics.Latency once per message.
+func (wm *WorkerManager) timedBatchStrategy(strategy BatchWorkerStrategy) BatchWorkerStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return func(worker *Worker, messages []*Message, ids []TaskId) []WorkerResult {
+		start := time.Now()
+		defer func() {
+			duration := time.Since(start)
+			for _ = range messages {
+				wm.partitionMetrics.Latency.Update(duration)
+			}
+		}()
+		return strategy(worker, messages, ids)
+	}
+}
+
 func (wm *WorkerManager) stopBatch() {
+	wm.abandonInFlightOffsets()
 	wm.currentBatch = make(map[TaskId]*Task)
+	inLock(&wm.workerQueuesLock, func() {
+		wm.workerQueues = make(map[*Worker][]*Task)
+	})
 	for _, worker := range wm.workers {
 		worker.OutputChannel = make(chan WorkerResult)
 	}
 }
 
 func (wm *WorkerManager) taskIsDone(result WorkerResult) {
-	Tracef(wm, "Task is done: %d", result.Id().Offset)
-	wm.UpdateLargestOffset(result.Id().Offset)
-	wm.availableWorkers <- wm.currentBatch[result.Id()].Callee
-	wm.activeWorkersCounter.Dec(1)
+	wm.offsetIsDone(result.Id().Offset)
+	wm.releaseWorker(wm.currentBatch[result.Id()].Callee)
+	delete(wm.currentBatch, result.Id())
+}
+
+func (wm *WorkerManager) taskIsAbandoned(result WorkerResult) {
+	wm.offsetIsAbandoned(result.Id().Offset)
+	wm.releaseWorker(wm.currentBatch[result.Id()].Callee)
 	delete(wm.currentBatch, result.Id())
 }
 
@@ -307,6 +891,183 @@ func (wm *WorkerManager) UpdateLargestOffset(offset int64) {
 	atomic.StoreInt64(&wm.largestOffset, int64(math.Max(float64(wm.largestOffset), float64(offset))))
 }
 
+// Returns the last offset successfully committed by this WorkerManager or InvalidOffset if nothing was committed yet.
+func (wm *WorkerManager) GetLastCommittedOffset() int64 {
+	return atomic.LoadInt64(&wm.lastCommittedOffset)
+}
+
+// Returns the number of messages this WorkerManager has received but not processed yet, including failed messages whose offsets are not committed.
+func (wm *WorkerManager) GetPendingTasks() int {
+	return wm.offsetTracker.pending()
+}
+
+// Gets the highest offset such that this offset and all offsets handed to workers before it are processed.
+// This is the offset this WorkerManager commits, so messages that are still being processed, retried or were not committed on failure are never skipped after restart.
+func (wm *WorkerManager) GetCommittableOffset() int64 {
+	return wm.offsetTracker.lowWatermark()
+}
+
+// Returns the lowest offset that failed and is not committed (see DoNotCommitOffsetAndContinue) or InvalidOffset if there is none.
+// As offsets are committed contiguously, no offsets after it are committed until the consumer restarts and processes it again.
+func (wm *WorkerManager) GetStuckOffset() int64 {
+	return wm.offsetTracker.lowestAbandoned()
+}
+
+// offsetTracker keeps track of offsets handed to workers in the order they were fetched and finds the highest contiguous completed offset.
+// Offsets do not have to be sequential (e.g. for compacted topics), only ascending.
+// Offsets that are completed or abandoned one after another are collapsed into a single run, so the tracker holds a few runs per offset in flight or abandoned
+// no matter how many offsets are completed after an abandoned one.
+type offsetTracker struct {
+	lock      sync.Mutex
+	runs      []*offsetRun
+	watermark int64
+}
+
+type offsetState int
+
+const (
+	offsetInFlight offsetState = iota
+	offsetCompleted
+	offsetAbandoned
+)
+
+// offsetRun is a number of offsets tracked one after another that are all in the same state. Offsets in flight are always tracked one per run.
+type offsetRun struct {
+	first int64
+	last  int64
+	count int
+	state offsetState
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		runs:      make([]*offsetRun, 0),
+		watermark: InvalidOffset,
+	}
+}
+
+// Starts tracking a given offset. Offsets that are not greater than previously tracked ones are ignored.
+func (t *offsetTracker) add(offset int64) {
+	inLock(&t.lock, func() {
+		if offset <= t.watermark || (len(t.runs) > 0 && offset <= t.runs[len(t.runs)-1].last) {
+			return
+		}
+		t.runs = append(t.runs, &offsetRun{first: offset, last: offset, count: 1, state: offsetInFlight})
+	})
+}
+
+// Marks a given offset completed and moves the watermark forward over all contiguous completed offsets.
+// Returns false if the offset is not in flight.
+func (t *offsetTracker) complete(offset int64) bool {
+	return t.finish(offset, offsetCompleted)
+}
+
+// Marks a given offset abandoned, so that it is never completed and the watermark does not move past it.
+// Returns false if the offset is not in flight.
+func (t *offsetTracker) abandon(offset int64) bool {
+	return t.finish(offset, offsetAbandoned)
+}
+
+func (t *offsetTracker) finish(offset int64, state offsetState) bool {
+	tracked := false
+	inLock(&t.lock, func() {
+		i := sort.Search(len(t.runs), func(i int) bool { return t.runs[i].last >= offset })
+		if i == len(t.runs) || t.runs[i].first != offset || t.runs[i].state != offsetInFlight {
+			return
+		}
+		tracked = true
+		t.runs[i].state = state
+		t.collapse(i)
+	})
+	return tracked
+}
+
+// Marks all offsets in flight abandoned, e.g. when the rest of a batch is not processed.
+// Returns the number of offsets abandoned.
+func (t *offsetTracker) abandonInFlight() int {
+	abandoned := 0
+	inLock(&t.lock, func() {
+		for i := len(t.runs) - 1; i >= 0; i-- {
+			if i < len(t.runs) && t.runs[i].state == offsetInFlight {
+				t.runs[i].state = offsetAbandoned
+				abandoned++
+				t.collapse(i)
+			}
+		}
+	})
+	return abandoned
+}
+
+// Merges the run at a given index with its neighbours in the same state and moves the watermark over completed runs at the head.
+func (t *offsetTracker) collapse(i int) {
+	if i+1 < len(t.runs) && t.runs[i+1].state == t.runs[i].state {
+		t.runs[i].last = t.runs[i+1].last
+		t.runs[i].count += t.runs[i+1].count
+		t.runs = append(t.runs[:i+1], t.runs[i+2:]...)
+	}
+	if i > 0 && t.runs[i-1].state == t.runs[i].state {
+		t.runs[i-1].last = t.runs[i].last
+		t.runs[i-1].count += t.runs[i].count
+		t.runs = append(t.runs[:i], t.runs[i+1:]...)
+	}
+	for len(t.runs) > 0 && t.runs[0].state == offsetCompleted {
+		t.watermark = t.runs[0].last
+		t.runs = t.runs[1:]
+	}
+}
+
+// Stops tracking all offsets and moves the watermark to a given offset.
+func (t *offsetTracker) reset(watermark int64) {
+	inLock(&t.lock, func() {
+		t.runs = make([]*offsetRun, 0)
+		t.watermark = watermark
+	})
+}
+
+// Returns the number of tracked offsets that are not completed yet, including abandoned ones.
+func (t *offsetTracker) pending() int {
+	pending := 0
+	inLock(&t.lock, func() {
+		for _, run := range t.runs {
+			if run.state != offsetCompleted {
+				pending += run.count
+			}
+		}
+	})
+	return pending
+}
+
+func (t *offsetTracker) lowWatermark() int64 {
+	var watermark int64
+	inLock(&t.lock, func() {
+		watermark = t.watermark
+	})
+	return watermark
+}
+
+// Returns the lowest abandoned offset or InvalidOffset if no offset is abandoned.
+func (t *offsetTracker) lowestAbandoned() int64 {
+	abandoned := InvalidOffset
+	inLock(&t.lock, func() {
+		for _, run := range t.runs {
+			if run.state == offsetAbandoned {
+				abandoned = run.first
+				return
+			}
+		}
+	})
+	return abandoned
+}
+
+// Returns the number of runs this tracker holds.
+func (t *offsetTracker) size() int {
+	var size int
+	inLock(&t.lock, func() {
+		size = len(t.runs)
+	})
+	return size
+}
+
 // Represents a worker that is able to process a single message.
 type Worker struct {
 	// Channel to write processing results to.
@@ -343,15 +1104,65 @@ func (w *Worker) Start(task *Task, strategy WorkerStrategy) {
 	}()
 }
 
+// Processes given tasks at once using given batch strategy with this worker.
+// Call to this method blocks until the strategy returns or TaskTimeout elapses. Returned results are in the same order as tasks.
+// Tasks the strategy did not return a result for are considered failed, and all tasks are considered timed out if the strategy does not return in time.
+func (w *Worker) ProcessBatch(tasks []*Task, strategy BatchWorkerStrategy) []WorkerResult {
+	messages := make([]*Message, len(tasks))
+	ids := make([]TaskId, len(tasks))
+	for i, task := range tasks {
+		task.Callee = w
+		messages[i] = task.Msg
+		ids[i] = task.Id()
+	}
+
+	results := make([]WorkerResult, len(tasks))
+	resultChannel := make(chan []WorkerResult, 1)
+	go func() { resultChannel <- strategy(w, messages, ids) }()
+	select {
+	case strategyResults := <-resultChannel:
+		{
+			resultsById := make(map[TaskId]WorkerResult)
+			for _, result := range strategyResults {
+				if result != nil {
+					resultsById[result.Id()] = result
+				}
+			}
+			for i, id := range ids {
+				if result, exists := resultsById[id]; exists {
+					results[i] = result
+				} else {
+					results[i] = NewProcessingFailedResult(id)
+				}
+			}
+		}
+	case <-time.After(w.TaskTimeout):
+		{
+			for i, id := range ids {
+				results[i] = &TimedOutResult{id}
+			}
+		}
+	}
+
+	return results
+}
+
 // Defines what to do with a single Kafka message. Returns a WorkerResult to distinguish successful and unsuccessful processings.
 type WorkerStrategy func(*Worker, *Message, TaskId) WorkerResult
 
+// Defines what to do with a whole batch of Kafka messages. Returns a WorkerResult for each message to distinguish successful and unsuccessful processings.
+// Messages and their TaskIds are passed in the same order.
+type BatchWorkerStrategy func(*Worker, []*Message, []TaskId) []WorkerResult
+
 // A callback that is triggered when a worker fails to process ConsumerConfig.WorkerRetryThreshold messages within ConsumerConfig.WorkerThresholdTimeWindow
 type FailedCallback func(*WorkerManager) FailedDecision
 
 // A callback that is triggered when a worker fails to process a single message.
 type FailedAttemptCallback func(*Task, WorkerResult) FailedDecision
 
+// A callback that is triggered after an offset of a given partition is committed, or with an error if it could not be committed after all retries.
+type CommitCallback func(topicPartition TopicAndPartition, offset int64, err error)
+
 // A counter used to track whether we reached the configurable threshold of failed messages within a given time window.
 type FailureCounter struct {
 	count           int32
@@ -506,6 +1317,7 @@ const (
 	CommitOffsetAndContinue FailedDecision = iota
 
 	// Tells the worker manager to continue processing new messages but not to commit offset that failed.
+	// As offsets are committed contiguously, no offsets after the failed one are committed either, so the failed message is redelivered after restart.
 	DoNotCommitOffsetAndContinue
 
 	// Tells the worker manager to commit offset and stop processing the current batch.
@@ -513,4 +1325,13 @@ const (
 
 	// Tells the worker manager not to commit offset and stop processing the current batch.
 	DoNotCommitOffsetAndStop
+
+	// Tells the worker manager to send the failed message to ConsumerConfig.DeadLetterTopic, commit offset and continue normally.
+	// If the message could not be sent, its offset is not committed as with DoNotCommitOffsetAndContinue.
+	SendToDeadLetterTopicAndContinue
+
+	// Tells the worker manager to send the failed message to the next retry topic (see ConsumerConfig.RetryTopicDelays), commit offset and continue normally.
+	// Once all retry topics are used, the message is sent to ConsumerConfig.DeadLetterTopic as with SendToDeadLetterTopicAndContinue.
+	// If the message could not be sent, its offset is not committed as with DoNotCommitOffsetAndContinue.
+	SendToRetryTopicAndContinue
 )
@@ -16,8 +16,10 @@
 package go_kafka_client
 
 import (
+	"encoding/json"
 	"fmt"
 	metrics "github.com/rcrowley/go-metrics"
+	"sync"
 	"testing"
 	"time"
 )
@@ -113,8 +115,9 @@ func TestWorkerManager(t *testing.T) {
 	config := DefaultConsumerConfig()
 	config.NumWorkers = 3
 	config.Strategy = goodStrategy
-	mockZk := newMockZookeeperCoordinator()
-	config.Coordinator = mockZk
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
 	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
 
 	wmsIdleTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry)
@@ -122,8 +125,9 @@ func TestWorkerManager(t *testing.T) {
 	activeWorkersCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry)
 	pendingWMsTasksCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry)
 
+	partitionMetrics := NewPartitionMetrics()
 	manager := NewWorkerManager(wmid, config, topicPartition, wmsIdleTimer,
-		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter)
+		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter, partitionMetrics)
 
 	go manager.Start()
 
@@ -134,7 +138,7 @@ func TestWorkerManager(t *testing.T) {
 	checkAllWorkersAvailable(t, manager)
 
 	batch := []*Message{
-		&Message{Offset: 0},
+		&Message{Offset: 0, Key: []byte("key"), Value: []byte("value")},
 		&Message{Offset: 1},
 		&Message{Offset: 2},
 		&Message{Offset: 3},
@@ -150,12 +154,657 @@ func TestWorkerManager(t *testing.T) {
 	<-manager.Stop()
 
 	//make sure we don't lose our offsets
-	if len(mockZk.commitHistory) != 1 {
+	if len(offsetStore.offsets[config.Groupid]) != 1 {
 		t.Errorf("Worker manager should commit offset only once")
 	}
-	if mockZk.commitHistory[topicPartition] != 5 {
+	if offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition); offset != 5 {
 		t.Errorf("Worker manager should commit offset 5")
 	}
+
+	assert(t, partitionMetrics.Messages.Count(), int64(6))
+	assert(t, partitionMetrics.Bytes.Count(), int64(8))
+	assert(t, partitionMetrics.Failures.Count(), int64(0))
+	assert(t, partitionMetrics.Latency.Count(), int64(6))
+}
+
+func TestWorkerManagerCommitsContiguousOffsets(t *testing.T) {
+	wmid := "test-WM-contiguous"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.MaxWorkerRetries = 0
+	config.WorkerThresholdTimeWindow = 1 * time.Minute
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		if msg.Offset == 2 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	partitionMetrics := NewPartitionMetrics()
+	manager := NewWorkerManager(wmid, config, topicPartition,
+		metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry), partitionMetrics)
+	go manager.Start()
+
+	batch := make([]*Message, 0)
+	for i := 0; i < 6; i++ {
+		batch = append(batch, &Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i)})
+	}
+	manager.inputChannel <- batch
+	time.Sleep(1 * time.Second)
+
+	<-manager.Stop()
+
+	assert(t, manager.GetLargestOffset(), int64(5))
+	//offset 2 was not committed, so nothing after it should be committed either
+	offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(1))
+	assert(t, partitionMetrics.Messages.Count(), int64(5))
+	assert(t, partitionMetrics.Failures.Count(), int64(1))
+}
+
+func TestWorkerManagerAbandonedOffset(t *testing.T) {
+	wmid := "test-WM-abandoned"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.MaxWorkerRetries = 0
+	config.WorkerThresholdTimeWindow = 1 * time.Minute
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		if msg.Offset == 2 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	manager := NewWorkerManager(wmid, config, topicPartition,
+		metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry),
+		metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry), NewPartitionMetrics())
+	go manager.Start()
+
+	batches := 200
+	batchSize := 10
+	for i := 0; i < batches; i++ {
+		batch := make([]*Message, 0)
+		for j := 0; j < batchSize; j++ {
+			batch = append(batch, &Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i*batchSize + j)})
+		}
+		manager.inputChannel <- batch
+	}
+
+	<-manager.Stop()
+
+	assert(t, manager.GetLargestOffset(), int64(batches*batchSize-1))
+	//offsets processed after the abandoned one are not kept one by one
+	assert(t, manager.offsetTracker.size(), 2)
+	assert(t, manager.GetPendingTasks(), 1)
+	assert(t, manager.GetStuckOffset(), int64(2))
+	offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(1))
+}
+
+func TestWorkerManagerKeyOrderedProcessing(t *testing.T) {
+	wmid := "test-WM-key-ordered"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.KeyOrderedProcessing = true
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	processedLock := sync.Mutex{}
+	processed := make(map[string][]int64)
+	processedBy := make(map[string]*Worker)
+	config.Strategy = func(worker *Worker, msg *Message, id TaskId) WorkerResult {
+		//later offsets finish faster so that unordered processing would be noticed
+		time.Sleep(time.Duration(10-msg.Offset) * 10 * time.Millisecond)
+		inLock(&processedLock, func() {
+			key := string(msg.Key)
+			processed[key] = append(processed[key], msg.Offset)
+			if processedBy[key] == nil {
+				processedBy[key] = worker
+			} else if processedBy[key] != worker {
+				t.Errorf("Messages with key %s were processed by different workers", key)
+			}
+		})
+		return NewSuccessfulResult(id)
+	}
+
+	wmsIdleTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry)
+	wmsBatchDurationTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry)
+	activeWorkersCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry)
+	pendingWMsTasksCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry)
+
+	manager := NewWorkerManager(wmid, config, topicPartition, wmsIdleTimer,
+		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter, NewPartitionMetrics())
+
+	go manager.Start()
+
+	keys := []string{"a", "b", "c", "d"}
+	batch := make([]*Message, 0)
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &Message{Key: []byte(keys[i%len(keys)]), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i)})
+	}
+
+	manager.inputChannel <- batch
+
+	time.Sleep(2 * time.Second)
+	checkAllWorkersAvailable(t, manager)
+	assert(t, activeWorkersCounter.Count(), int64(0))
+	assert(t, pendingWMsTasksCounter.Count(), int64(0))
+
+	<-manager.Stop()
+
+	for i, key := range keys {
+		expected := make([]int64, 0)
+		for offset := int64(i); offset < 10; offset += int64(len(keys)) {
+			expected = append(expected, offset)
+		}
+		assert(t, processed[key], expected)
+	}
+	if offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition); offset != 9 {
+		t.Errorf("Worker manager should commit offset 9, actual %d", offset)
+	}
+}
+
+func TestWorkerManagerBatchStrategy(t *testing.T) {
+	wmid := "test-WM-batch"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.MaxWorkerRetries = 1
+	config.WorkerBackoff = 100 * time.Millisecond
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	calls := make([][]int64, 0)
+	config.BatchStrategy = func(_ *Worker, msgs []*Message, ids []TaskId) []WorkerResult {
+		offsets := make([]int64, 0)
+		results := make([]WorkerResult, 0)
+		for i, msg := range msgs {
+			offsets = append(offsets, msg.Offset)
+			if msg.Offset == 4 || (msg.Offset == 2 && len(calls) == 0) {
+				results = append(results, NewProcessingFailedResult(ids[i]))
+			} else if msg.Offset != 3 || len(calls) > 0 {
+				results = append(results, NewSuccessfulResult(ids[i]))
+			}
+		}
+		calls = append(calls, offsets)
+		return results
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+
+	wmsIdleTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry)
+	wmsBatchDurationTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry)
+	activeWorkersCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry)
+	pendingWMsTasksCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry)
+
+	manager := NewWorkerManager(wmid, config, topicPartition, wmsIdleTimer,
+		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter, NewPartitionMetrics())
+
+	go manager.Start()
+
+	batch := make([]*Message, 0)
+	for i := 0; i < 6; i++ {
+		batch = append(batch, &Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i)})
+	}
+
+	manager.inputChannel <- batch
+
+	time.Sleep(1 * time.Second)
+	checkAllWorkersAvailable(t, manager)
+	assert(t, activeWorkersCounter.Count(), int64(0))
+	assert(t, pendingWMsTasksCounter.Count(), int64(0))
+
+	<-manager.Stop()
+
+	//offset 3 had no result in the first call so it is retried along with failed offsets 2 and 4
+	assert(t, calls, [][]int64{[]int64{0, 1, 2, 3, 4, 5}, []int64{2, 3, 4}})
+	//offset 4 is not committed so only offsets up to 3 are committed
+	if offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition); offset != 3 {
+		t.Errorf("Worker manager should commit offset 3, actual %d", offset)
+	}
+}
+
+func TestWorkerManagerDeadLetterTopic(t *testing.T) {
+	wmid := "test-WM-dead-letter"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.MaxWorkerRetries = 1
+	config.WorkerBackoff = 100 * time.Millisecond
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	producer := newMockProducer()
+	config.DeadLetterTopic = "deadLetters"
+	config.DeadLetterProducer = producer
+	config.WorkerFailedAttemptCallback = DeadLetterFailedAttemptCallback
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		if msg.Offset == 1 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	wmsIdleTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry)
+	wmsBatchDurationTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry)
+	activeWorkersCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry)
+	pendingWMsTasksCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry)
+
+	manager := NewWorkerManager(wmid, config, topicPartition, wmsIdleTimer,
+		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter, NewPartitionMetrics())
+
+	go manager.Start()
+
+	batch := []*Message{
+		&Message{Key: []byte("key0"), Value: []byte("value0"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 0},
+		&Message{Key: []byte("key1"), Value: []byte("value1"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 1},
+		&Message{Key: []byte("key2"), Value: []byte("value2"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 2},
+	}
+
+	manager.inputChannel <- batch
+
+	time.Sleep(1 * time.Second)
+	checkAllWorkersAvailable(t, manager)
+
+	<-manager.Stop()
+
+	//failed message is sent to dead letter topic and committed
+	if offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition); offset != 2 {
+		t.Errorf("Worker manager should commit offset 2, actual %d", offset)
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("Worker manager should send exactly one dead letter, actual %d", len(producer.messages))
+	}
+	assert(t, producer.messages[0].Topic, config.DeadLetterTopic)
+	assert(t, producer.messages[0].Key, []byte("key1"))
+
+	deadLetter := &DeadLetter{}
+	if err := json.Unmarshal(producer.messages[0].Value, deadLetter); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, deadLetter.Topic, topicPartition.Topic)
+	assert(t, deadLetter.Partition, topicPartition.Partition)
+	assert(t, deadLetter.Offset, int64(1))
+	assert(t, deadLetter.Value, []byte("value1"))
+	assert(t, deadLetter.Reason, "Processing failed")
+	assert(t, deadLetter.Retries, 2)
+}
+
+func TestWorkerManagerRetryTopics(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 3
+	config.MaxWorkerRetries = 0
+	config.Coordinator = newMockZookeeperCoordinator()
+	config.OffsetStore = NewMemoryOffsetStore()
+	producer := newMockProducer()
+	config.RetryTopicDelays = []time.Duration{1 * time.Second, 1 * time.Minute}
+	config.RetryProducer = producer
+	config.DeadLetterTopic = "deadLetters"
+	config.DeadLetterProducer = producer
+	config.WorkerFailedAttemptCallback = RetryTopicFailedAttemptCallback
+
+	receivedLock := sync.Mutex{}
+	received := make([]*Message, 0)
+	receivedAt := make([]time.Time, 0)
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&receivedLock, func() {
+			received = append(received, msg)
+			receivedAt = append(receivedAt, time.Now())
+		})
+		if msg.Offset == 1 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+
+	//failed message goes to the first retry topic and the original partition is committed
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+	processTestBatch(t, "test-WM-retry", config, topicPartition, []*Message{
+		&Message{Key: []byte("key0"), Value: []byte("value0"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 0},
+		&Message{Key: []byte("key1"), Value: []byte("value1"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 1},
+	})
+	if offset, _ := config.OffsetStore.GetOffset(config.Groupid, &topicPartition); offset != 1 {
+		t.Errorf("Worker manager should commit offset 1, actual %d", offset)
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("Worker manager should send exactly one delayed retry, actual %d", len(producer.messages))
+	}
+	assert(t, producer.messages[0].Topic, "fakeTopic.retry.1s")
+	assert(t, producer.messages[0].Key, []byte("key1"))
+	retry := &DelayedRetry{}
+	if err := json.Unmarshal(producer.messages[0].Value, retry); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, retry.Topic, topicPartition.Topic)
+	assert(t, retry.Offset, int64(1))
+	assert(t, retry.Attempt, 1)
+
+	//message from retry topic is processed once it is due and is unwrapped before it is passed to strategy
+	received = make([]*Message, 0)
+	receivedAt = make([]time.Time, 0)
+	retryTopicPartition := TopicAndPartition{"fakeTopic.retry.1s", int32(0)}
+	processTestBatch(t, "test-WM-retry-1s", config, retryTopicPartition, []*Message{
+		&Message{Key: []byte("key1"), Value: producer.messages[0].Value, Topic: retryTopicPartition.Topic, Partition: retryTopicPartition.Partition, Offset: 0},
+	})
+	if len(received) != 1 {
+		t.Fatalf("Strategy should receive exactly one message, actual %d", len(received))
+	}
+	assert(t, received[0].Topic, topicPartition.Topic)
+	assert(t, received[0].Offset, int64(1))
+	assert(t, received[0].Value, []byte("value1"))
+	if receivedAt[0].Before(retry.RetryAt) {
+		t.Errorf("Message should not be retried before %s, actual %s", retry.RetryAt, receivedAt[0])
+	}
+	if len(producer.messages) != 2 {
+		t.Fatalf("Worker manager should send exactly one more delayed retry, actual %d", len(producer.messages))
+	}
+	assert(t, producer.messages[1].Topic, "fakeTopic.retry.1m")
+	if err := json.Unmarshal(producer.messages[1].Value, retry); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, retry.Attempt, 2)
+
+	//message goes to dead letter topic once all retry topics are used
+	retry.RetryAt = time.Now()
+	value, _ := json.Marshal(retry)
+	retryTopicPartition = TopicAndPartition{"fakeTopic.retry.1m", int32(0)}
+	processTestBatch(t, "test-WM-retry-1m", config, retryTopicPartition, []*Message{
+		&Message{Key: []byte("key1"), Value: value, Topic: retryTopicPartition.Topic, Partition: retryTopicPartition.Partition, Offset: 0},
+	})
+	if len(producer.messages) != 3 {
+		t.Fatalf("Worker manager should send exactly one dead letter, actual %d", len(producer.messages))
+	}
+	assert(t, producer.messages[2].Topic, config.DeadLetterTopic)
+	deadLetter := &DeadLetter{}
+	if err := json.Unmarshal(producer.messages[2].Value, deadLetter); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, deadLetter.Topic, topicPartition.Topic)
+	assert(t, deadLetter.Offset, int64(1))
+	if offset, _ := config.OffsetStore.GetOffset(config.Groupid, &retryTopicPartition); offset != 0 {
+		t.Errorf("Worker manager should commit offset 0, actual %d", offset)
+	}
+}
+
+func TestWorkerManagerDecoders(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 2
+	config.MaxWorkerRetries = 3
+	config.WorkerBackoff = 100 * time.Millisecond
+	config.Coordinator = newMockZookeeperCoordinator()
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	config.KeyDecoder = NewJsonDecoder(nil)
+	config.ValueDecoder = NewJsonDecoder(func() interface{} { return &testEvent{} })
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	var lock sync.Mutex
+	decoded := make(map[int64]*testEvent)
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&lock, func() {
+			decoded[msg.Offset] = msg.DecodedValue.(*testEvent)
+		})
+		return NewSuccessfulResult(id)
+	}
+	failures := make([]WorkerResult, 0)
+	config.WorkerFailedAttemptCallback = func(_ *Task, result WorkerResult) FailedDecision {
+		inLock(&lock, func() {
+			failures = append(failures, result)
+		})
+		return CommitOffsetAndContinue
+	}
+
+	batch := []*Message{
+		&Message{Key: []byte(`"key0"`), Value: []byte(`{"Name": "event0", "Count": 0}`), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 0},
+		&Message{Value: []byte("not a json"), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 1},
+		&Message{Value: []byte(`{"Name": "event2", "Count": 2}`), Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 2},
+	}
+	processTestBatch(t, "test-WM-decoders", config, topicPartition, batch)
+
+	assert(t, batch[0].DecodedKey, "key0")
+	assert(t, decoded, map[int64]*testEvent{0: &testEvent{"event0", 0}, 2: &testEvent{"event2", 2}})
+	//message that could not be decoded is not retried
+	assert(t, len(failures), 1)
+	if _, ok := failures[0].(*DecodingFailedResult); !ok {
+		t.Errorf("Expected DecodingFailedResult, actual %v", failures[0])
+	}
+	if offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition); offset != 2 {
+		t.Errorf("Worker manager should commit offset 2, actual %d", offset)
+	}
+
+	//batch strategy gets only decoded messages
+	config.Strategy = nil
+	calls := make([][]int64, 0)
+	config.BatchStrategy = func(_ *Worker, msgs []*Message, ids []TaskId) []WorkerResult {
+		offsets := make([]int64, 0)
+		results := make([]WorkerResult, 0)
+		for i, msg := range msgs {
+			offsets = append(offsets, msg.Offset)
+			results = append(results, NewSuccessfulResult(ids[i]))
+		}
+		calls = append(calls, offsets)
+		return results
+	}
+	failures = make([]WorkerResult, 0)
+	processTestBatch(t, "test-WM-batch-decoders", config, topicPartition, batch)
+	assert(t, calls, [][]int64{[]int64{0, 2}})
+	assert(t, len(failures), 1)
+}
+
+func processTestBatch(t *testing.T, wmid string, config *ConsumerConfig, topicPartition TopicAndPartition, batch []*Message) {
+	wmsIdleTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsIdleTime-%s", wmid), metrics.DefaultRegistry)
+	wmsBatchDurationTimer := metrics.NewRegisteredTimer(fmt.Sprintf("WMsBatchDuration-%s", wmid), metrics.DefaultRegistry)
+	activeWorkersCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsActiveWorkers-%s", wmid), metrics.DefaultRegistry)
+	pendingWMsTasksCounter := metrics.NewRegisteredCounter(fmt.Sprintf("WMsPendingTasks-%s", wmid), metrics.DefaultRegistry)
+
+	manager := NewWorkerManager(wmid, config, topicPartition, wmsIdleTimer,
+		wmsBatchDurationTimer, activeWorkersCounter, pendingWMsTasksCounter, NewPartitionMetrics())
+
+	go manager.Start()
+	manager.inputChannel <- batch
+	time.Sleep(2 * time.Second)
+	checkAllWorkersAvailable(t, manager)
+	<-manager.Stop()
+}
+
+func TestWorkerManagerCommitModes(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.OffsetCommitInterval = 1 * time.Hour
+	config.OffsetCommitMode = BatchCommit
+	offsetStore := NewMemoryOffsetStore()
+	config.OffsetStore = offsetStore
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+	newBatch := func(from int, to int) []*Message {
+		batch := make([]*Message, 0)
+		for i := from; i < to; i++ {
+			batch = append(batch, &Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: int64(i)})
+		}
+		return batch
+	}
+
+	//the next batch is accepted only after the previous one is committed
+	manager := NewWorkerManager("test-WM-batch-commit", config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+	go manager.Start()
+	manager.inputChannel <- newBatch(0, 4)
+	manager.inputChannel <- newBatch(4, 6)
+	offset, _ := offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(3))
+	<-manager.Stop()
+	offset, _ = offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(5))
+
+	//nothing is committed automatically in manual mode, not even on stop
+	config.OffsetCommitMode = ManualCommit
+	topicPartition = TopicAndPartition{"fakeTopic", int32(1)}
+	manager = NewWorkerManager("test-WM-manual-commit", config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+	go manager.Start()
+	manager.inputChannel <- newBatch(0, 4)
+	<-manager.Stop()
+	offset, _ = offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, InvalidOffset)
+
+	consumer := &Consumer{config: config, workerManagers: map[TopicAndPartition]*WorkerManager{topicPartition: manager}}
+	assert(t, consumer.Commit(), nil)
+	offset, _ = offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(3))
+	assert(t, manager.GetLastCommittedOffset(), int64(3))
+
+	assert(t, consumer.CommitPartition(topicPartition, 10), nil)
+	offset, _ = offsetStore.GetOffset(config.Groupid, &topicPartition)
+	assert(t, offset, int64(10))
+	assert(t, manager.GetLastCommittedOffset(), int64(10))
+	assertNot(t, consumer.CommitPartition(TopicAndPartition{"fakeTopic", int32(2)}, 10), nil)
+
+	//commit errors are returned
+	config.OffsetsCommitMaxRetries = 0
+	config.OffsetStore, _ = NewFileOffsetStore("/nonexistent/directory/offsets.json")
+	assertNot(t, consumer.CommitPartition(topicPartition, 11), nil)
+	assert(t, manager.GetLastCommittedOffset(), int64(10))
+
+	config.OffsetCommitMode = "sometimes"
+	assertNot(t, config.Validate(), nil)
+}
+
+func TestWorkerManagerCommitFailures(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.OffsetCommitMode = BatchCommit
+	config.OffsetsCommitMaxRetries = 2
+	config.OffsetsCommitBackoff = 50 * time.Millisecond
+	config.OffsetStore, _ = NewFileOffsetStore("/nonexistent/directory/offsets.json")
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+	commits := make(chan error, 10)
+	config.OnCommit = func(committed TopicAndPartition, offset int64, err error) {
+		assert(t, committed, topicPartition)
+		assert(t, offset, int64(0))
+		commits <- err
+	}
+
+	manager := NewWorkerManager("test-WM-commit-failures", config, topicPartition, metrics.NewTimer(), metrics.NewTimer(),
+		metrics.NewCounter(), metrics.NewCounter(), NewPartitionMetrics())
+	consumer := &Consumer{
+		config: config,
+		fetcher: &consumerFetcherManager{
+			askNext:          make(chan TopicAndPartition, 10),
+			pausedPartitions: make(map[TopicAndPartition]bool),
+			pausedAsks:       make(map[TopicAndPartition]bool),
+		},
+		workerManagers: map[TopicAndPartition]*WorkerManager{topicPartition: manager},
+	}
+	manager.commitFailed = consumer.handleCommitFailure
+	go manager.Start()
+
+	//failed commits are retried with backoff and then reported to the callback and the consumer
+	start := time.Now()
+	manager.inputChannel <- []*Message{&Message{Topic: topicPartition.Topic, Partition: topicPartition.Partition, Offset: 0}}
+	manager.inputChannel <- []*Message{}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Errorf("Offset commit retries should back off, took %s", time.Since(start))
+	}
+	assertNot(t, <-commits, nil)
+	assert(t, len(commits), 0)
+	assert(t, manager.GetLastCommittedOffset(), InvalidOffset)
+	assert(t, consumer.Paused(), []TopicAndPartition{})
+
+	config.CommitFailurePolicy = PauseOnCommitFailure
+	consumer.handleCommitFailure(topicPartition)
+	assert(t, consumer.Paused(), []TopicAndPartition{topicPartition})
+
+	config.OffsetStore = NewMemoryOffsetStore()
+	<-manager.Stop()
+	assert(t, <-commits, nil)
+	assert(t, manager.GetLastCommittedOffset(), int64(0))
+
+	config.CommitFailurePolicy = "sometimes"
+	assertNot(t, config.Validate(), nil)
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tracker := newOffsetTracker()
+	assert(t, tracker.lowWatermark(), InvalidOffset)
+
+	//offsets may have gaps
+	for _, offset := range []int64{0, 1, 2, 5, 6} {
+		tracker.add(offset)
+	}
+
+	tracker.complete(1)
+	assert(t, tracker.lowWatermark(), InvalidOffset)
+
+	tracker.complete(0)
+	assert(t, tracker.lowWatermark(), int64(1))
+
+	tracker.complete(5)
+	tracker.complete(6)
+	assert(t, tracker.lowWatermark(), int64(1))
+
+	tracker.complete(2)
+	assert(t, tracker.lowWatermark(), int64(6))
+
+	//already tracked and untracked offsets are ignored
+	tracker.add(3)
+	tracker.complete(4)
+	assert(t, tracker.lowWatermark(), int64(6))
+
+	tracker.add(7)
+	tracker.complete(7)
+	assert(t, tracker.lowWatermark(), int64(7))
+
+	//abandoned offset is never passed, while offsets completed after it are collapsed
+	for offset := int64(8); offset < 1000; offset++ {
+		tracker.add(offset)
+	}
+	assert(t, tracker.abandon(8), true)
+	assert(t, tracker.abandon(8), false)
+	assert(t, tracker.complete(8), false)
+	for offset := int64(999); offset > 8; offset-- {
+		tracker.complete(offset)
+	}
+	assert(t, tracker.lowWatermark(), int64(7))
+	assert(t, tracker.lowestAbandoned(), int64(8))
+	assert(t, tracker.pending(), 1)
+	assert(t, tracker.size(), 2)
+
+	//offsets in flight are abandoned together when a batch is stopped
+	for offset := int64(1000); offset < 1010; offset++ {
+		tracker.add(offset)
+	}
+	tracker.complete(1005)
+	assert(t, tracker.abandonInFlight(), 9)
+	assert(t, tracker.pending(), 10)
+	assert(t, tracker.size(), 5)
+	assert(t, tracker.lowestAbandoned(), int64(8))
+
+	tracker.reset(1009)
+	assert(t, tracker.lowWatermark(), int64(1009))
+	assert(t, tracker.lowestAbandoned(), InvalidOffset)
+	assert(t, tracker.size(), 0)
 }
 
 func checkAllWorkersAvailable(t *testing.T, wm *WorkerManager) {
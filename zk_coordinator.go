@@ -74,11 +74,12 @@ func (this *ZookeeperCoordinator) tryConnect() error {
 	return err
 }
 
-/* Registers a new consumer with Consumerid id and TopicCount subscription that is a part of consumer group Groupid in this ConsumerCoordinator. Returns an error if registration failed, nil otherwise. */
-func (this *ZookeeperCoordinator) RegisterConsumer(Consumerid string, Groupid string, TopicCount TopicsToNumStreams) error {
+/* Registers a new consumer with Consumerid id and TopicCount subscription that is a part of consumer group Groupid in this ConsumerCoordinator.
+Weight and Tags are advertised to partition assignors of the group in ConsumerInfo. Returns an error if registration failed, nil otherwise. */
+func (this *ZookeeperCoordinator) RegisterConsumer(Consumerid string, Groupid string, TopicCount TopicsToNumStreams, Weight int, Tags map[string]string) error {
 	var err error
 	for i := 0; i <= this.config.MaxRequestRetries; i++ {
-		err := this.tryRegisterConsumer(Consumerid, Groupid, TopicCount)
+		err := this.tryRegisterConsumer(Consumerid, Groupid, TopicCount, Weight, Tags)
 		if err == nil {
 			return err
 		}
@@ -88,7 +89,7 @@ func (this *ZookeeperCoordinator) RegisterConsumer(Consumerid string, Groupid st
 	return err
 }
 
-func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid string, TopicCount TopicsToNumStreams) error {
+func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid string, TopicCount TopicsToNumStreams, Weight int, Tags map[string]string) error {
 	Debugf(this, "Trying to register consumer %s at group %s in Zookeeper", Consumerid, Groupid)
 	registryDir := newZKGroupDirs(Groupid).ConsumerRegistryDir
 	pathToConsumer := fmt.Sprintf("%s/%s", registryDir, Consumerid)
@@ -97,6 +98,8 @@ func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid
 		Subscription: TopicCount.GetTopicsToNumStreamsMap(),
 		Pattern:      TopicCount.Pattern(),
 		Timestamp:    time.Now().Unix(),
+		Weight:       Weight,
+		Tags:         Tags,
 	})
 	if mappingError != nil {
 		return mappingError
@@ -330,7 +333,7 @@ func (this *ZookeeperCoordinator) tryGetAllBrokers() ([]*BrokerInfo, error) {
 }
 
 // Gets the offset for a given TopicPartition and consumer group Groupid.
-// Returns offset on sucess, error otherwise.
+// Returns offset on sucess, error otherwise. Used by ZookeeperOffsetStore.
 func (this *ZookeeperCoordinator) GetOffsetForTopicPartition(Groupid string, TopicPartition *TopicAndPartition) (int64, error) {
 	var err error
 	for i := 0; i <= this.config.MaxRequestRetries; i++ {
@@ -643,8 +646,60 @@ func (this *ZookeeperCoordinator) tryReleasePartitionOwnership(Groupid string, T
 	return nil
 }
 
-// Tells the ConsumerCoordinator to commit offset Offset for topic and partition TopicPartition for consumer group Groupid.
-// Returns error if failed to commit offset.
+// Gets the current owners of all claimed partitions of given Topics within consumer group Groupid.
+// Returns a map where keys are topic-partitions and values are consumer thread ids that claimed them, and error on failure. Partitions nobody owns are not in the map.
+func (this *ZookeeperCoordinator) GetPartitionOwners(Groupid string, Topics []string) (map[TopicAndPartition]ConsumerThreadId, error) {
+	var owners map[TopicAndPartition]ConsumerThreadId
+	var err error
+	for i := 0; i <= this.config.MaxRequestRetries; i++ {
+		owners, err = this.tryGetPartitionOwners(Groupid, Topics)
+		if err == nil {
+			return owners, err
+		}
+		Tracef(this, "GetPartitionOwners for group %s and topics %s failed after %d-th retry", Groupid, Topics, i)
+		time.Sleep(this.config.RequestBackoff)
+	}
+	return nil, err
+}
+
+func (this *ZookeeperCoordinator) tryGetPartitionOwners(Groupid string, Topics []string) (map[TopicAndPartition]ConsumerThreadId, error) {
+	owners := make(map[TopicAndPartition]ConsumerThreadId)
+	for _, topic := range Topics {
+		ownerDir := newZKGroupTopicDirs(Groupid, topic).ConsumerOwnerDir
+		partitions, _, err := this.zkConn.Children(ownerDir)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, partition := range partitions {
+			data, _, err := this.zkConn.Get(fmt.Sprintf("%s/%s", ownerDir, partition))
+			if err == zk.ErrNoNode {
+				//released after listing
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			partitionId, err := strconv.Atoi(partition)
+			if err != nil {
+				return nil, err
+			}
+			owner, err := parseConsumerThreadId(string(data))
+			if err != nil {
+				return nil, err
+			}
+			owners[TopicAndPartition{topic, int32(partitionId)}] = owner
+		}
+	}
+
+	return owners, nil
+}
+
+// Tells the ZookeeperCoordinator to commit offset Offset for topic and partition TopicPartition for consumer group Groupid.
+// Returns error if failed to commit offset. Used by ZookeeperOffsetStore.
 func (this *ZookeeperCoordinator) CommitOffset(Groupid string, TopicPartition *TopicAndPartition, Offset int64) error {
 	dirs := newZKGroupTopicDirs(Groupid, TopicPartition.Topic)
 	return this.createOrUpdatePathParentMayNotExist(fmt.Sprintf("%s/%d", dirs.ConsumerOffsetDir, TopicPartition.Partition), []byte(strconv.FormatInt(Offset, 10)))
@@ -864,17 +919,15 @@ func newZKGroupTopicDirs(group string, topic string) *zkGroupTopicDirs {
 
 //used for tests only
 type mockZookeeperCoordinator struct {
-	commitHistory map[TopicAndPartition]int64
+	brokers []*BrokerInfo
 }
 
 func newMockZookeeperCoordinator() *mockZookeeperCoordinator {
-	return &mockZookeeperCoordinator{
-		commitHistory: make(map[TopicAndPartition]int64),
-	}
+	return &mockZookeeperCoordinator{}
 }
 
-func (mzk *mockZookeeperCoordinator) Connect() error { panic("Not implemented") }
-func (mzk *mockZookeeperCoordinator) RegisterConsumer(consumerid string, group string, topicCount TopicsToNumStreams) error {
+func (mzk *mockZookeeperCoordinator) Connect() error { return nil }
+func (mzk *mockZookeeperCoordinator) RegisterConsumer(consumerid string, group string, topicCount TopicsToNumStreams, weight int, tags map[string]string) error {
 	panic("Not implemented")
 }
 func (mzk *mockZookeeperCoordinator) DeregisterConsumer(consumerid string, group string) error {
@@ -893,10 +946,7 @@ func (mzk *mockZookeeperCoordinator) GetAllTopics() ([]string, error) { panic("N
 func (mzk *mockZookeeperCoordinator) GetPartitionsForTopics(topics []string) (map[string][]int32, error) {
 	panic("Not implemented")
 }
-func (mzk *mockZookeeperCoordinator) GetAllBrokers() ([]*BrokerInfo, error) { panic("Not implemented") }
-func (mzk *mockZookeeperCoordinator) GetOffsetForTopicPartition(group string, topicPartition *TopicAndPartition) (int64, error) {
-	panic("Not implemented")
-}
+func (mzk *mockZookeeperCoordinator) GetAllBrokers() ([]*BrokerInfo, error) { return mzk.brokers, nil }
 func (mzk *mockZookeeperCoordinator) NotifyConsumerGroup(group string, consumerId string) error {
 	panic("Not implemented")
 }
@@ -916,7 +966,6 @@ func (mzk *mockZookeeperCoordinator) ClaimPartitionOwnership(group string, topic
 func (mzk *mockZookeeperCoordinator) ReleasePartitionOwnership(group string, topic string, partition int32) error {
 	panic("Not implemented")
 }
-func (mzk *mockZookeeperCoordinator) CommitOffset(group string, topicPartition *TopicAndPartition, offset int64) error {
-	mzk.commitHistory[*topicPartition] = offset
-	return nil
+func (mzk *mockZookeeperCoordinator) GetPartitionOwners(group string, topics []string) (map[TopicAndPartition]ConsumerThreadId, error) {
+	panic("Not implemented")
 }
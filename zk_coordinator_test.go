@@ -104,7 +104,7 @@ func testRegisterConsumer(t *testing.T) {
 		ExcludeInternalTopics: true,
 	}
 
-	err := coordinator.RegisterConsumer(fmt.Sprintf(consumerIdPattern, 0), consumerGroup, topicCount)
+	err := coordinator.RegisterConsumer(fmt.Sprintf(consumerIdPattern, 0), consumerGroup, topicCount, 0, nil)
 	if err != nil {
 		t.Error(err)
 	}